@@ -0,0 +1,213 @@
+package rackhd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// bastionAddr returns the bastion host with the default SSH port added when
+// the flag did not include one.
+func (d *Driver) bastionAddr() string {
+	if _, _, err := net.SplitHostPort(d.SSHBastion); err != nil {
+		return net.JoinHostPort(d.SSHBastion, "22")
+	}
+	return d.SSHBastion
+}
+
+// getBastionClient returns the SSH connection to the bastion host, dialing
+// it on first use and again after the connection has died. Authentication
+// uses --rackhd-ssh-bastion-key if given, and otherwise the keys held by
+// ssh-agent.
+func (d *Driver) getBastionClient() (*cryptossh.Client, error) {
+	d.bastionLock.Lock()
+	defer d.bastionLock.Unlock()
+
+	if d.bastionClient != nil {
+		return d.bastionClient, nil
+	}
+
+	auth := []cryptossh.AuthMethod{}
+	if d.SSHBastionKey != "" {
+		buf, err := ioutil.ReadFile(d.SSHBastionKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := cryptossh.ParsePrivateKey(buf)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse SSH bastion key %q. Error: %s", d.SSHBastionKey, err)
+		}
+		auth = append(auth, cryptossh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			log.Debugf("Unable to connect to ssh-agent at %s: %s", sock, err)
+		} else {
+			defer conn.Close()
+			auth = append(auth, cryptossh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("No credentials for SSH bastion %s. Specify --rackhd-ssh-bastion-key or run ssh-agent", d.SSHBastion)
+	}
+
+	config := &cryptossh.ClientConfig{
+		User: d.SSHBastionUser,
+		Auth: auth,
+	}
+
+	log.Debugf("Connecting to SSH bastion %s@%s", d.SSHBastionUser, d.bastionAddr())
+	client, err := cryptossh.Dial("tcp", d.bastionAddr(), config)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to SSH bastion %s. Error: %s", d.SSHBastion, err)
+	}
+	d.bastionClient = client
+
+	// forget the connection once it is closed, so the next dial through the
+	// bastion reconnects instead of failing for the rest of the process
+	go func() {
+		client.Wait()
+		log.Debugf("Connection to SSH bastion %s closed", d.SSHBastion)
+		d.bastionLock.Lock()
+		defer d.bastionLock.Unlock()
+		if d.bastionClient == client {
+			d.bastionClient = nil
+		}
+	}()
+	return client, nil
+}
+
+// dialNode opens a TCP connection to addr on the node, through the bastion
+// host when one is configured.
+func (d *Driver) dialNode(addr string) (net.Conn, error) {
+	if d.SSHBastion == "" {
+		return net.Dial("tcp", addr)
+	}
+
+	client, err := d.getBastionClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", addr)
+}
+
+// sshTunnelPort returns the local port of a listener that forwards to the
+// node's SSH port through the bastion host, starting the listener on first
+// use. It lives as long as the plugin process, which is what lets libmachine
+// provision and run SSH commands against nodes it cannot reach directly.
+func (d *Driver) sshTunnelPort() (int, error) {
+	d.bastionLock.Lock()
+	defer d.bastionLock.Unlock()
+
+	if d.sshTunnel == nil {
+		listener, err := d.startTunnel(0, d.getSSHPort)
+		if err != nil {
+			return 0, err
+		}
+		d.sshTunnel = listener
+	}
+
+	return d.sshTunnel.Addr().(*net.TCPAddr).Port, nil
+}
+
+// engineTunnelPort returns the local port that forwards to the node's Docker
+// engine port through the bastion host. The port is chosen once and saved
+// with the machine, so the URL handed to the docker CLI stays the same
+// between commands. When it is already taken, by another docker-machine
+// command or by a tunnel the user keeps open for the docker CLI, the saved
+// port is returned as is.
+func (d *Driver) engineTunnelPort() (int, error) {
+	d.bastionLock.Lock()
+	defer d.bastionLock.Unlock()
+
+	if d.engineTunnel == nil {
+		listener, err := d.startTunnel(d.EngineTunnelPort, d.getEnginePort)
+		if err != nil {
+			if d.EngineTunnelPort == 0 {
+				return 0, err
+			}
+			log.Debugf("Unable to forward the Docker engine of node %v: %s", d.NodeID, err)
+			return d.EngineTunnelPort, nil
+		}
+		d.engineTunnel = listener
+		d.EngineTunnelPort = listener.Addr().(*net.TCPAddr).Port
+	}
+
+	return d.EngineTunnelPort, nil
+}
+
+// startTunnel listens on localPort of the loopback interface, or on any free
+// port when it is 0, and forwards every connection to the node port returned
+// by nodePort through the bastion host.
+func (d *Driver) startTunnel(localPort int, nodePort func() int) (net.Listener, error) {
+	if _, err := d.GetIP(); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(localPort)))
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Forwarding %s to port %d of node %v through SSH bastion %s", listener.Addr(), nodePort(), d.NodeID, d.SSHBastion)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.forwardToNode(conn, nodePort())
+		}
+	}()
+	return listener, nil
+}
+
+// forwardToNode connects local to port on the node. The node address is
+// looked up for every connection, as waitForSSH may move the node to a new
+// IP address while the tunnel is open.
+func (d *Driver) forwardToNode(local net.Conn, port int) {
+	defer local.Close()
+
+	ip, err := d.GetIP()
+	if err != nil {
+		log.Debugf("Unable to forward to node %v: %s", d.NodeID, err)
+		return
+	}
+	target := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	remote, err := d.dialNode(target)
+	if err != nil {
+		log.Debugf("Unable to forward to %s: %s", target, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// parseBastion splits a [user@]host[:port] bastion specification.
+func parseBastion(spec string) (user, host string) {
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return "", spec
+}
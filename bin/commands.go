@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/codedellemc/docker-machine-rackhd"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+const driverName = "rackhd"
+
+// command is an operation docker-machine has no command for, run by passing
+// its name to the plugin binary. docker-machine itself always starts the
+// plugin without arguments.
+type command struct {
+	usage string
+	// run performs the command on the machine and reports whether the
+	// machine configuration has to be saved afterwards
+	run func(d *rackhd.Driver, args []string) (bool, error)
+}
+
+var commands = map[string]command{
+	"boot-override": {
+		usage: "boot-override <machine> <target>",
+		run:   bootOverride,
+	},
+	"inventory": {
+		usage: "inventory <machine> [--refresh]",
+		run:   inventory,
+	},
+	"reprovision": {
+		usage: "reprovision <machine>",
+		run:   reprovision,
+	},
+}
+
+func usage() error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msg := "This is a Docker Machine plugin binary. Besides being run by docker-machine, it accepts these commands:\n"
+	for _, name := range names {
+		msg += fmt.Sprintf("  %s [-s <storage path>] %s\n", os.Args[0], commands[name].usage)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// defaultStorePath is the store of docker-machine, honouring the same
+// MACHINE_STORAGE_PATH variable.
+func defaultStorePath() string {
+	if path := os.Getenv("MACHINE_STORAGE_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker", "machine")
+}
+
+func runCommand(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usage()
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	storePath := flags.String("s", defaultStorePath(), "docker-machine storage path")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 {
+		return usage()
+	}
+
+	configPath := filepath.Join(*storePath, "machines", flags.Arg(0), "config.json")
+	config, d, err := loadMachine(configPath)
+	if err != nil {
+		return err
+	}
+
+	save, err := cmd.run(d, flags.Args()[1:])
+	if save {
+		// save even if the command failed part way, so that the machine
+		// configuration matches the node
+		if saveErr := saveMachine(configPath, config, d); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// loadMachine reads the configuration docker-machine stored for a machine
+// and returns it along with the driver of the machine.
+func loadMachine(configPath string) (map[string]json.RawMessage, *rackhd.Driver, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to read machine configuration. Error: %s", err)
+	}
+
+	config := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse machine configuration %s. Error: %s", configPath, err)
+	}
+
+	var name string
+	if err := json.Unmarshal(config["DriverName"], &name); err != nil || name != driverName {
+		return nil, nil, fmt.Errorf("Machine configuration %s does not belong to the %s driver", configPath, driverName)
+	}
+
+	d := rackhd.NewDriver("", "")
+	if err := json.Unmarshal(config["Driver"], d); err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse driver configuration in %s. Error: %s", configPath, err)
+	}
+	return config, d, nil
+}
+
+// saveMachine writes the driver back into the machine configuration, leaving
+// the settings docker-machine owns as they were.
+func saveMachine(configPath string, config map[string]json.RawMessage, d *rackhd.Driver) error {
+	driver, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	config["Driver"] = driver
+
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, data, 0600)
+}
+
+func reprovision(d *rackhd.Driver, args []string) (bool, error) {
+	if err := d.Reprovision(); err != nil {
+		return true, err
+	}
+	fmt.Printf("Machine %s has been reprovisioned. Run \"docker-machine provision %s\" to reinstall Docker.\n", d.MachineName, d.MachineName)
+	return true, nil
+}
+
+func bootOverride(d *rackhd.Driver, args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, fmt.Errorf("A boot target is required, such as Pxe or Hdd")
+	}
+	if err := d.SetBootOverride(args[0]); err != nil {
+		return false, err
+	}
+	fmt.Printf("Machine %s boots from %s once. Run \"docker-machine start %s\" or \"docker-machine restart %s\" to boot it.\n", d.MachineName, args[0], d.MachineName, d.MachineName)
+	return false, nil
+}
+
+func inventory(d *rackhd.Driver, args []string) (bool, error) {
+	refresh := len(args) > 0 && args[0] == "--refresh"
+	data, err := d.Inventory(refresh)
+	if err != nil {
+		return false, err
+	}
+	fmt.Println(string(data))
+	return false, nil
+}
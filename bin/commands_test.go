@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `{
+    "ConfigVersion": 3,
+    "Driver": {
+        "IPAddress": "10.1.1.20",
+        "MachineName": "rackhdtest",
+        "SSHUser": "core",
+        "NodeID": "57e2d8ba8b2ba9aa3e6cfa41",
+        "WorkflowName": "Graph.InstallCoreOS"
+    },
+    "DriverName": "rackhd",
+    "HostOptions": {"EngineOptions": {"StorageDriver": "overlay"}},
+    "Name": "rackhdtest"
+}`
+
+func TestLoadSaveMachine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rackhd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(testConfig), 0600))
+
+	config, d, err := loadMachine(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "57e2d8ba8b2ba9aa3e6cfa41", d.NodeID)
+	assert.Equal(t, "Graph.InstallCoreOS", d.WorkflowName)
+	assert.Equal(t, "rackhdtest", d.MachineName)
+
+	d.IPAddress = "10.1.1.21"
+	assert.NoError(t, saveMachine(configPath, config, d))
+
+	_, d, err = loadMachine(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.1.21", d.IPAddress)
+	assert.Equal(t, "57e2d8ba8b2ba9aa3e6cfa41", d.NodeID)
+
+	saved := make(map[string]interface{})
+	data, err := ioutil.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, map[string]interface{}{"EngineOptions": map[string]interface{}{"StorageDriver": "overlay"}}, saved["HostOptions"], "Settings of docker-machine should be kept")
+}
+
+func TestLoadMachineOtherDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rackhd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	assert.NoError(t, ioutil.WriteFile(configPath, []byte(`{"DriverName": "virtualbox", "Driver": {}}`), 0600))
+
+	_, _, err = loadMachine(configPath)
+	assert.Error(t, err)
+
+	_, _, err = loadMachine(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
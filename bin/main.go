@@ -1,10 +1,20 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/codedellemc/docker-machine-rackhd"
 	"github.com/docker/machine/libmachine/drivers/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	plugin.RegisterDriver(new(rackhd.Driver))
 }
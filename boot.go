@@ -0,0 +1,118 @@
+package rackhd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	bootOverrideOnce = "Once"
+
+	// redfishRequestTimeoutSecs bounds each request made outside the
+	// generated Redfish client, so a hung endpoint cannot block a command
+	redfishRequestTimeoutSecs = 30
+)
+
+var redfishHTTPClient = &http.Client{Timeout: redfishRequestTimeoutSecs * time.Second}
+
+// bootTargets are the boot sources Redfish defines, used when the system
+// does not list the ones it allows.
+var bootTargets = []string{"None", "Pxe", "Floppy", "Cd", "Usb", "Hdd", "BiosSetup", "Utilities", "Diags", "UefiShell", "UefiTarget"}
+
+// systemBoot is the Boot property of a Redfish ComputerSystem. The generated
+// Redfish client has no support for changing it, so it is read and patched
+// directly.
+type systemBoot struct {
+	BootSourceOverrideEnabled string   `json:"BootSourceOverrideEnabled,omitempty"`
+	BootSourceOverrideTarget  string   `json:"BootSourceOverrideTarget,omitempty"`
+	AllowableTargets          []string `json:"BootSourceOverrideTarget@Redfish.AllowableValues,omitempty"`
+}
+
+// validateBootTarget returns target as spelled in allowed, which defaults to
+// the targets Redfish defines.
+func validateBootTarget(target string, allowed []string) (string, error) {
+	if len(allowed) == 0 {
+		allowed = bootTargets
+	}
+	for _, t := range allowed {
+		if strings.EqualFold(t, target) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported boot target %q. Specify one of %s", target, strings.Join(allowed, ", "))
+}
+
+func (d *Driver) systemURL() string {
+	return fmt.Sprintf("%s://%s/redfish/v1/Systems/%s", d.Transport, d.Endpoint, d.NodeID)
+}
+
+func (d *Driver) redfishRequest(method, url string, body interface{}, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := redfishHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %s: %s", method, url, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if out != nil && len(respBody) > 0 {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// SetBootOverride makes the node boot from target, such as Pxe or Hdd, on
+// its next boot only, through the Boot property of its Redfish system. It is
+// meant to be followed by Start or Restart.
+func (d *Driver) SetBootOverride(target string) error {
+	var system struct {
+		Boot systemBoot `json:"Boot"`
+	}
+	if err := d.redfishRequest("GET", d.systemURL(), nil, &system); err != nil {
+		return fmt.Errorf("Unable to retrieve boot settings of node %v. Error: %s", d.NodeID, err)
+	}
+
+	target, err := validateBootTarget(target, system.Boot.AllowableTargets)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Setting one-time boot override of node %v to %s", d.NodeID, target)
+	patch := map[string]interface{}{
+		"Boot": systemBoot{
+			BootSourceOverrideEnabled: bootOverrideOnce,
+			BootSourceOverrideTarget:  target,
+		},
+	}
+	if err := d.redfishRequest("PATCH", d.systemURL(), patch, nil); err != nil {
+		return fmt.Errorf("Unable to set boot override of node %v. Error: %s", d.NodeID, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBootTarget(t *testing.T) {
+	target, err := validateBootTarget("pxe", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Pxe", target)
+
+	target, err = validateBootTarget("HDD", []string{"Pxe", "Hdd"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hdd", target)
+
+	_, err = validateBootTarget("Cd", []string{"Pxe", "Hdd"})
+	assert.Error(t, err, "Targets the system does not allow should be rejected")
+
+	_, err = validateBootTarget("network", nil)
+	assert.Error(t, err)
+}
+
+func TestSetBootOverride(t *testing.T) {
+	var patched map[string]systemBoot
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/redfish/v1/Systems/aabbccdd", r.URL.Path)
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"Id": "aabbccdd", "Boot": {"BootSourceOverrideEnabled": "Disabled", "BootSourceOverrideTarget@Redfish.AllowableValues": ["Pxe", "Hdd"]}}`))
+		case "PATCH":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&patched))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	d := NewDriver("default", "path")
+	d.Endpoint = strings.TrimPrefix(server.URL, "http://")
+	d.Transport = "http"
+	d.NodeID = "aabbccdd"
+
+	assert.NoError(t, d.SetBootOverride("pxe"))
+	assert.Equal(t, "Pxe", patched["Boot"].BootSourceOverrideTarget)
+	assert.Equal(t, "Once", patched["Boot"].BootSourceOverrideEnabled)
+
+	patched = nil
+	assert.Error(t, d.SetBootOverride("Cd"))
+	assert.Nil(t, patched, "Nothing should be patched for a target the system does not allow")
+}
+
+func TestRedfishRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	timeout := redfishHTTPClient.Timeout
+	redfishHTTPClient.Timeout = 100 * time.Millisecond
+	defer func() { redfishHTTPClient.Timeout = timeout }()
+
+	d := NewDriver("default", "path")
+	d.Endpoint = strings.TrimPrefix(server.URL, "http://")
+	d.Transport = "http"
+	d.NodeID = "aabbccdd"
+
+	assert.Error(t, d.SetBootOverride("pxe"), "A hung Redfish endpoint should time out")
+}
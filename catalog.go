@@ -0,0 +1,72 @@
+package rackhd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/codedellemc/gorackhd/client/nodes"
+)
+
+// nodeHardware is the capacity of a node as reported by its catalogs.
+type nodeHardware struct {
+	CPUs     int
+	MemoryMB int
+}
+
+// ohaiCatalog holds the parts of the ohai catalog gathered during discovery
+// that the driver uses.
+type ohaiCatalog struct {
+	Data struct {
+		CPU struct {
+			Total int `json:"total"`
+		} `json:"cpu"`
+		Memory struct {
+			Total string `json:"total"`
+		} `json:"memory"`
+	} `json:"data"`
+}
+
+func (d *Driver) getCatalog(client *apiclientMonorail.Monorail, nodeID, source string, out interface{}) error {
+	params := nodes.NewGetNodesIdentifierCatalogsSourceParams()
+	params.WithIdentifier(nodeID)
+	params.WithSource(source)
+	resp, err := client.Nodes.GetNodesIdentifierCatalogsSource(params, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve %s catalog of node %v. Error: %s", source, nodeID, err)
+	}
+	return decodePayload(resp.Payload, out)
+}
+
+func (d *Driver) getNodeHardware(client *apiclientMonorail.Monorail, nodeID string) (*nodeHardware, error) {
+	catalog := &ohaiCatalog{}
+	if err := d.getCatalog(client, nodeID, "ohai", catalog); err != nil {
+		return nil, err
+	}
+
+	memoryMB, err := parseOhaiMemory(catalog.Data.Memory.Total)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeHardware{
+		CPUs:     catalog.Data.CPU.Total,
+		MemoryMB: memoryMB,
+	}, nil
+}
+
+// parseOhaiMemory converts an ohai memory size such as "16333444kB" to MB.
+func parseOhaiMemory(size string) (int, error) {
+	units := map[string]int{"kb": 1024, "mb": 1024 * 1024, "gb": 1024 * 1024 * 1024, "b": 1}
+	lower := strings.ToLower(strings.TrimSpace(size))
+	for _, unit := range []string{"kb", "mb", "gb", "b"} {
+		if strings.HasSuffix(lower, unit) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(lower, unit), 10, 64)
+			if err != nil {
+				break
+			}
+			return int(n * int64(units[unit]) / (1024 * 1024)), nil
+		}
+	}
+	return 0, fmt.Errorf("Unable to parse memory size %q", size)
+}
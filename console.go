@@ -0,0 +1,197 @@
+package rackhd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	consoleLogFile         = "console.log"
+	consoleTailLines       = 20
+	consoleCommandTemplate = "console"
+	defaultConsoleCommand  = "ipmitool -I lanplus -H {{.Host}} -U {{.User}} -E sol activate"
+
+	// consolePasswordEnv carries the BMC password to the console command,
+	// which ipmitool -E reads, so it does not show up in ps
+	consolePasswordEnv = "IPMI_PASSWORD"
+)
+
+// consoleParams are the values a --rackhd-console-command template can use,
+// taken from the OBM settings of the node.
+type consoleParams struct {
+	NodeID   string
+	Host     string
+	User     string
+	Password string
+}
+
+// splitCommand splits a command template into arguments at whitespace
+// outside of {{ }} actions, so that actions may be spelled {{ .Host }}.
+func splitCommand(command string) []string {
+	fields := []string{}
+	field := ""
+	depth := 0
+	for i := 0; i < len(command); i++ {
+		switch {
+		case strings.HasPrefix(command[i:], "{{"):
+			depth++
+			field += "{{"
+			i++
+		case strings.HasPrefix(command[i:], "}}") && depth > 0:
+			depth--
+			field += "}}"
+			i++
+		case depth == 0 && strings.ContainsRune(" \t\n", rune(command[i])):
+			if field != "" {
+				fields = append(fields, field)
+				field = ""
+			}
+		default:
+			field += string(command[i])
+		}
+	}
+	if field != "" {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// renderConsoleCommand splits the command into arguments before rendering
+// them, so that values containing spaces stay a single argument.
+func renderConsoleCommand(command string, params consoleParams) ([]string, error) {
+	var args []string
+	for _, field := range splitCommand(command) {
+		tmpl, err := template.New(consoleCommandTemplate).Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid console command %q. Error: %s", command, err)
+		}
+		var arg bytes.Buffer
+		if err := tmpl.Execute(&arg, params); err != nil {
+			return nil, fmt.Errorf("Invalid console command %q. Error: %s", command, err)
+		}
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("The console command is empty")
+	}
+	return args, nil
+}
+
+// runConsoleCapture starts args with its output appended to logPath and the
+// BMC password in its environment. The returned function stops the command.
+func runConsoleCapture(args []string, password, logPath string) (func(), error) {
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), consolePasswordEnv+"="+password)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// ipmitool ends the session when its input is closed, so keep it open
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+
+	return func() {
+		stdin.Close()
+		select {
+		case <-done:
+		default:
+			cmd.Process.Kill()
+			<-done
+		}
+		logFile.Close()
+	}, nil
+}
+
+// consoleTail returns the last lines of the console log.
+func consoleTail(logPath string, lines int) string {
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		return ""
+	}
+	all := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// startConsoleCapture starts capturing the serial console of the node with
+// --rackhd-console-command. Failing to capture does not fail the create, so
+// it only logs problems and then returns a function that does nothing.
+func (d *Driver) startConsoleCapture(client *apiclientMonorail.Monorail) func() {
+	noop := func() {}
+
+	obm, err := d.getObm(client)
+	if err != nil {
+		log.Warnf("Unable to capture the console of node %v, its OBM settings are not usable. Error: %s", d.NodeID, err)
+		return noop
+	}
+
+	command := d.ConsoleCommand
+	if command == "" {
+		command = defaultConsoleCommand
+	}
+	args, err := renderConsoleCommand(command, consoleParams{
+		NodeID:   d.NodeID,
+		Host:     obm.configString("host"),
+		User:     obm.configString("user"),
+		Password: obm.configString("password"),
+	})
+	if err != nil {
+		log.Warnf("Unable to capture the console of node %v. Error: %s", d.NodeID, err)
+		return noop
+	}
+
+	logPath := d.ResolveStorePath(consoleLogFile)
+	stop, err := runConsoleCapture(args, obm.configString("password"), logPath)
+	if err != nil {
+		log.Warnf("Unable to capture the console of node %v. Error: %s", d.NodeID, err)
+		return noop
+	}
+	log.Infof("Capturing the console of node %v to %s", d.NodeID, logPath)
+	return stop
+}
+
+// waitForInstall waits for the install workflow like waitForWorkflow, with
+// the console captured when --rackhd-console-capture is set. The end of the
+// capture is added to the error if the workflow fails.
+func (d *Driver) waitForInstall(client *apiclientMonorail.Monorail, wfInstance string) error {
+	if !d.ConsoleCapture {
+		return d.waitForWorkflow(client, wfInstance, d.WFTimeout, d.WFPollInterval)
+	}
+
+	stop := d.startConsoleCapture(client)
+	err := d.waitForWorkflow(client, wfInstance, d.WFTimeout, d.WFPollInterval)
+	stop()
+	if err != nil {
+		logPath := d.ResolveStorePath(consoleLogFile)
+		if tail := consoleTail(logPath, consoleTailLines); tail != "" {
+			return fmt.Errorf("%s\nLast console output of node %v (full log in %s):\n%s", err, d.NodeID, logPath, tail)
+		}
+	}
+	return err
+}
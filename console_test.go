@@ -0,0 +1,74 @@
+package rackhd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderConsoleCommand(t *testing.T) {
+	args, err := renderConsoleCommand(defaultConsoleCommand, consoleParams{Host: "10.1.1.5", User: "admin", Password: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ipmitool", "-I", "lanplus", "-H", "10.1.1.5", "-U", "admin", "-E", "sol", "activate"}, args, "The password should not be on the command line")
+
+	args, err = renderConsoleCommand("bmc-console -p {{.Password}}", consoleParams{Password: "pass word"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bmc-console", "-p", "pass word"}, args)
+
+	args, err = renderConsoleCommand("rackhd-sol {{.NodeID}}", consoleParams{NodeID: "aabbccdd"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rackhd-sol", "aabbccdd"}, args)
+
+	args, err = renderConsoleCommand("ipmitool  -H {{ .Host }} -U {{ .User }}\tsol activate", consoleParams{Host: "10.1.1.5", User: "admin"})
+	assert.NoError(t, err, "Spaces inside actions should be allowed")
+	assert.Equal(t, []string{"ipmitool", "-H", "10.1.1.5", "-U", "admin", "sol", "activate"}, args)
+
+	args, err = renderConsoleCommand("console --target=node:{{ .NodeID }}", consoleParams{NodeID: "aabbccdd"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"console", "--target=node:aabbccdd"}, args)
+
+	_, err = renderConsoleCommand("ipmitool -H {{.Host", consoleParams{})
+	assert.Error(t, err)
+
+	_, err = renderConsoleCommand("  ", consoleParams{})
+	assert.Error(t, err)
+}
+
+func TestRunConsoleCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rackhd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, consoleLogFile)
+
+	stop, err := runConsoleCapture([]string{"sh", "-c", "echo booting $IPMI_PASSWORD; echo installing; sleep 60"}, "secret", logPath)
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	stop()
+
+	assert.Equal(t, "installing", consoleTail(logPath, 1))
+	assert.Equal(t, "booting secret\ninstalling", consoleTail(logPath, 20), "The password should be passed in the environment")
+
+	_, err = runConsoleCapture([]string{filepath.Join(dir, "missing")}, "", logPath)
+	assert.Error(t, err)
+}
+
+func TestConsoleTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rackhd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, consoleLogFile)
+
+	assert.Equal(t, "", consoleTail(logPath, 5), "A missing log has no tail")
+
+	lines := []string{}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	assert.NoError(t, ioutil.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	assert.Equal(t, strings.Join(lines[25:], "\n"), consoleTail(logPath, 5))
+}
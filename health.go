@@ -0,0 +1,78 @@
+package rackhd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const healthCheckTimeoutSecs = 5
+
+// dialWithTimeout runs dial, giving up after timeout. SSH connections through
+// the bastion host cannot be given a deadline, so the dial is raced against
+// a timer, and a connection that arrives too late is closed.
+func dialWithTimeout(dial func() (net.Conn, error), timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := dial()
+		done <- result{conn, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// probePort reports whether addr accepts TCP connections within timeout,
+// dialing through the bastion host if one is configured.
+func (d *Driver) probePort(addr string, timeout time.Duration) bool {
+	var conn net.Conn
+	var err error
+	if d.SSHBastion == "" {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	} else {
+		conn, err = dialWithTimeout(func() (net.Conn, error) { return d.dialNode(addr) }, timeout)
+	}
+	if err != nil {
+		log.Debugf("Health check failed on %v: %s", addr, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// checkHealth is used with --rackhd-health-check once the BMC reports the
+// node as powered on. The host counts as up when either its SSH or its
+// Docker engine port answers, so a machine that is still being provisioned
+// is not reported as broken. A hung OS or a node stuck in a PXE loop
+// answers on neither.
+func (d *Driver) checkHealth() (state.State, error) {
+	if d.IPAddress == "" {
+		return state.Error, fmt.Errorf("Node %v is powered on but has no IP address", d.NodeID)
+	}
+
+	timeout := healthCheckTimeoutSecs * time.Second
+	ports := []int{d.getSSHPort(), d.getEnginePort()}
+	for _, port := range ports {
+		if d.probePort(net.JoinHostPort(d.IPAddress, strconv.Itoa(port)), timeout) {
+			return state.Running, nil
+		}
+	}
+	return state.Error, fmt.Errorf("Node %v is powered on but %v is not answering on ports %v", d.NodeID, d.IPAddress, ports)
+}
@@ -0,0 +1,70 @@
+package rackhd
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	d := NewDriver("default", "path")
+	d.IPAddress = "127.0.0.1"
+	d.SSHPort = port
+
+	s, err := d.checkHealth()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+
+	listener.Close()
+	s, err = d.checkHealth()
+	assert.Error(t, err, "A host answering on neither port should be reported")
+	assert.Equal(t, state.Error, s)
+
+	d.IPAddress = ""
+	s, err = d.checkHealth()
+	assert.Error(t, err)
+	assert.Equal(t, state.Error, s)
+}
+
+func TestDialWithTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	conn, err := dialWithTimeout(func() (net.Conn, error) { return net.Dial("tcp", listener.Addr().String()) }, time.Second)
+	assert.NoError(t, err)
+	conn.Close()
+
+	// a dial that hangs, like one through a bastion to a dead node
+	release := make(chan struct{})
+	defer close(release)
+	start := time.Now()
+	_, err = dialWithTimeout(func() (net.Conn, error) {
+		<-release
+		return nil, fmt.Errorf("released")
+	}, 100*time.Millisecond)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second, "The dial should be abandoned after the timeout")
+}
+
+func TestProbePort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	d := NewDriver("default", "path")
+	assert.True(t, d.probePort(listener.Addr().String(), time.Second))
+
+	addr := listener.Addr().String()
+	listener.Close()
+	assert.False(t, d.probePort(addr, time.Second))
+}
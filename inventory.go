@@ -0,0 +1,303 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codedellemc/gorackhd-redfish/client/redfish_v1"
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const inventoryFile = "inventory.json"
+
+// inventory is the hardware of the node a machine runs on, as stored in
+// inventory.json in the machine directory.
+type inventory struct {
+	NodeID       string          `json:"nodeId"`
+	CollectedAt  string          `json:"collectedAt"`
+	Vendor       string          `json:"vendor"`
+	Model        string          `json:"model"`
+	SerialNumber string          `json:"serialNumber"`
+	BIOSVersion  string          `json:"biosVersion"`
+	CPUs         int             `json:"cpus"`
+	CPUModel     string          `json:"cpuModel"`
+	MemoryMB     int             `json:"memoryMB"`
+	Disks        []inventoryDisk `json:"disks"`
+	NICs         []inventoryNIC  `json:"nics"`
+	BMC          inventoryBMC    `json:"bmc"`
+}
+
+type inventoryDisk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	SizeGB     int    `json:"sizeGB"`
+	Rotational bool   `json:"rotational"`
+}
+
+type inventoryNIC struct {
+	Name        string   `json:"name"`
+	MAC         string   `json:"mac"`
+	SpeedMbps   int      `json:"speedMbps"`
+	IPAddresses []string `json:"ipAddresses"`
+}
+
+type inventoryBMC struct {
+	IPAddress  string `json:"ipAddress"`
+	MACAddress string `json:"macAddress"`
+}
+
+// dmiCatalog holds the parts of the dmi catalog the inventory uses.
+type dmiCatalog struct {
+	Data struct {
+		System struct {
+			Manufacturer string `json:"Manufacturer"`
+			ProductName  string `json:"Product Name"`
+			SerialNumber string `json:"Serial Number"`
+		} `json:"System Information"`
+		BIOS struct {
+			Version string `json:"Version"`
+		} `json:"BIOS Information"`
+	} `json:"data"`
+}
+
+// bmcCatalog holds the parts of the bmc catalog the inventory uses.
+type bmcCatalog struct {
+	Data struct {
+		IPAddress  string `json:"IP Address"`
+		MACAddress string `json:"MAC Address"`
+	} `json:"data"`
+}
+
+// ohaiDevices holds the parts of the ohai catalog that describe the CPUs,
+// drives and network interfaces of the node.
+type ohaiDevices struct {
+	Data struct {
+		CPU struct {
+			First struct {
+				ModelName string `json:"model_name"`
+			} `json:"0"`
+		} `json:"cpu"`
+		BlockDevice map[string]struct {
+			Size       string `json:"size"`
+			Model      string `json:"model"`
+			Rotational string `json:"rotational"`
+		} `json:"block_device"`
+		Network struct {
+			Interfaces map[string]struct {
+				Addresses map[string]struct {
+					Family string `json:"family"`
+				} `json:"addresses"`
+			} `json:"interfaces"`
+		} `json:"network"`
+	} `json:"data"`
+}
+
+// lshwDevice is a device in the lshw catalog, which lists the hardware of
+// the node as a tree. Sizes and capacities of network devices are in bit/s.
+type lshwDevice struct {
+	Class       string       `json:"class"`
+	LogicalName interface{}  `json:"logicalname"`
+	Size        int64        `json:"size"`
+	Capacity    int64        `json:"capacity"`
+	Children    []lshwDevice `json:"children"`
+}
+
+type lshwCatalog struct {
+	Data lshwDevice `json:"data"`
+}
+
+// nicSpeeds returns the link speed in Mb/s of the network devices in the
+// tree by interface name. The negotiated speed is preferred over the
+// capacity of the device.
+func nicSpeeds(device lshwDevice, speeds map[string]int) {
+	if name, ok := device.LogicalName.(string); ok && device.Class == "network" {
+		speed := device.Size
+		if speed == 0 {
+			speed = device.Capacity
+		}
+		speeds[name] = int(speed / 1000000)
+	}
+	for _, child := range device.Children {
+		nicSpeeds(child, speeds)
+	}
+}
+
+// redfishSystem holds the parts of the Redfish ComputerSystem the inventory
+// uses.
+type redfishSystem struct {
+	Manufacturer     string `json:"Manufacturer"`
+	Model            string `json:"Model"`
+	SerialNumber     string `json:"SerialNumber"`
+	BiosVersion      string `json:"BiosVersion"`
+	ProcessorSummary struct {
+		Count int    `json:"Count"`
+		Model string `json:"Model"`
+	} `json:"ProcessorSummary"`
+}
+
+// firstOf returns the first value that is set.
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// inventorySources are the catalogs and the Redfish system of a node. A
+// source that is not available is left empty.
+type inventorySources struct {
+	dmi     dmiCatalog
+	ohai    ohaiCatalog
+	devices ohaiDevices
+	bmc     bmcCatalog
+	lshw    lshwCatalog
+	system  redfishSystem
+}
+
+// buildInventory combines the sources of a node. Redfish is preferred where
+// it and a catalog describe the same fact.
+func buildInventory(nodeID string, src *inventorySources) *inventory {
+	dmi, ohai, devices, bmc, system := &src.dmi, &src.ohai, &src.devices, &src.bmc, &src.system
+	inv := &inventory{
+		NodeID:       nodeID,
+		Vendor:       firstOf(system.Manufacturer, dmi.Data.System.Manufacturer),
+		Model:        firstOf(system.Model, dmi.Data.System.ProductName),
+		SerialNumber: firstOf(system.SerialNumber, dmi.Data.System.SerialNumber),
+		BIOSVersion:  firstOf(system.BiosVersion, dmi.Data.BIOS.Version),
+		CPUs:         ohai.Data.CPU.Total,
+		CPUModel:     firstOf(system.ProcessorSummary.Model, devices.Data.CPU.First.ModelName),
+		Disks:        []inventoryDisk{},
+		NICs:         []inventoryNIC{},
+		BMC: inventoryBMC{
+			IPAddress:  bmc.Data.IPAddress,
+			MACAddress: bmc.Data.MACAddress,
+		},
+	}
+	if inv.CPUs == 0 {
+		inv.CPUs = system.ProcessorSummary.Count
+	}
+	if memoryMB, err := parseOhaiMemory(ohai.Data.Memory.Total); err == nil {
+		inv.MemoryMB = memoryMB
+	}
+
+	diskNames := []string{}
+	for name := range devices.Data.BlockDevice {
+		diskNames = append(diskNames, name)
+	}
+	sort.Strings(diskNames)
+	for _, name := range diskNames {
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		disk := devices.Data.BlockDevice[name]
+		// ohai reports the size in 512 byte sectors
+		sectors, _ := strconv.ParseInt(disk.Size, 10, 64)
+		inv.Disks = append(inv.Disks, inventoryDisk{
+			Name:       name,
+			Model:      strings.TrimSpace(disk.Model),
+			SizeGB:     int(sectors * 512 / 1000000000),
+			Rotational: disk.Rotational == "1",
+		})
+	}
+
+	nicNames := []string{}
+	for name := range devices.Data.Network.Interfaces {
+		nicNames = append(nicNames, name)
+	}
+	sort.Strings(nicNames)
+	speeds := make(map[string]int)
+	nicSpeeds(src.lshw.Data, speeds)
+	for _, name := range nicNames {
+		if name == "lo" {
+			continue
+		}
+		iface := devices.Data.Network.Interfaces[name]
+		nic := inventoryNIC{Name: name, SpeedMbps: speeds[name], IPAddresses: []string{}}
+		for addr, info := range iface.Addresses {
+			switch info.Family {
+			case "lladdr":
+				nic.MAC = strings.ToLower(addr)
+			case "inet", "inet6":
+				nic.IPAddresses = append(nic.IPAddresses, addr)
+			}
+		}
+		sort.Strings(nic.IPAddresses)
+		inv.NICs = append(inv.NICs, nic)
+	}
+
+	return inv
+}
+
+// collectInventory gathers the inventory of the node. A source that is not
+// available, such as a catalog of a node discovered without it, is skipped.
+func (d *Driver) collectInventory(client *apiclientMonorail.Monorail) *inventory {
+	src := &inventorySources{}
+
+	catalogs := map[string][]interface{}{
+		"dmi":  {&src.dmi},
+		"ohai": {&src.ohai, &src.devices},
+		"bmc":  {&src.bmc},
+		"lshw": {&src.lshw},
+	}
+	for source, outs := range catalogs {
+		// each catalog is downloaded once and decoded into all its outputs
+		var raw json.RawMessage
+		if err := d.getCatalog(client, d.NodeID, source, &raw); err != nil {
+			log.Debugf("Leaving %s catalog out of the inventory. Error: %s", source, err)
+			continue
+		}
+		for _, out := range outs {
+			if err := json.Unmarshal(raw, out); err != nil {
+				log.Debugf("Leaving %s catalog out of the inventory. Error: %s", source, err)
+				break
+			}
+		}
+	}
+
+	clientRedfish := d.getClientRedfish()
+	if resp, err := clientRedfish.RedfishV1.GetSystem(&redfish_v1.GetSystemParams{Identifier: d.NodeID}); err != nil {
+		log.Debugf("Leaving Redfish system out of the inventory. Error: %s", err)
+	} else if err := decodePayload(resp.Payload, &src.system); err != nil {
+		log.Debugf("Leaving Redfish system out of the inventory. Error: %s", err)
+	}
+
+	inv := buildInventory(d.NodeID, src)
+	inv.CollectedAt = time.Now().UTC().Format(time.RFC3339)
+	return inv
+}
+
+// saveInventory stores the inventory in the machine directory.
+func (d *Driver) saveInventory(inv *inventory) ([]byte, error) {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(d.ResolveStorePath(inventoryFile), data, 0644); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Inventory returns the hardware inventory of the machine's node as JSON,
+// as stored when the machine was created. With refresh, or for machines
+// created before inventories were kept, it is collected again first.
+func (d *Driver) Inventory(refresh bool) ([]byte, error) {
+	if !refresh {
+		data, err := ioutil.ReadFile(d.ResolveStorePath(inventoryFile))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return d.saveInventory(d.collectInventory(d.getClientMonorail()))
+}
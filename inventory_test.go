@@ -0,0 +1,90 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOhaiCatalog = `{
+  "source": "ohai",
+  "data": {
+    "cpu": {"total": 32, "0": {"model_name": "Intel(R) Xeon(R) CPU E5-2650 v2 @ 2.60GHz"}},
+    "memory": {"total": "264097704kB"},
+    "block_device": {
+      "sda": {"size": "1953525168", "model": "ST1000NM0033-9ZM", "rotational": "1"},
+      "sdb": {"size": "937703088", "model": "INTEL SSDSC2BB48", "rotational": "0"},
+      "loop0": {"size": "0", "rotational": "1"}
+    },
+    "network": {
+      "interfaces": {
+        "lo": {"addresses": {"127.0.0.1": {"family": "inet"}}},
+        "eth1": {"addresses": {"00:1E:67:AB:CD:02": {"family": "lladdr"}}},
+        "eth0": {"addresses": {"00:1E:67:AB:CD:01": {"family": "lladdr"}, "172.31.128.10": {"family": "inet"}}}
+      }
+    }
+  }
+}`
+
+const testDmiCatalog = `{
+  "source": "dmi",
+  "data": {
+    "System Information": {"Manufacturer": "Intel Corporation", "Product Name": "S2600KP", "Serial Number": "BQWL51200123"},
+    "BIOS Information": {"Version": "SE5C610.86B.01.01.0016"}
+  }
+}`
+
+const testLshwCatalog = `{
+  "source": "lshw",
+  "data": {
+    "class": "system",
+    "children": [{
+      "class": "bus",
+      "children": [
+        {"class": "network", "logicalname": "eth0", "size": 10000000000, "capacity": 10000000000},
+        {"class": "network", "logicalname": "eth1", "capacity": 1000000000},
+        {"class": "storage", "logicalname": ["/dev/sda", "/dev/sda1"]}
+      ]
+    }]
+  }
+}`
+
+func TestBuildInventory(t *testing.T) {
+	src := &inventorySources{}
+	assert.NoError(t, json.Unmarshal([]byte(testOhaiCatalog), &src.ohai))
+	assert.NoError(t, json.Unmarshal([]byte(testOhaiCatalog), &src.devices))
+	assert.NoError(t, json.Unmarshal([]byte(testDmiCatalog), &src.dmi))
+	assert.NoError(t, json.Unmarshal([]byte(testLshwCatalog), &src.lshw))
+	assert.NoError(t, json.Unmarshal([]byte(`{"data": {"IP Address": "10.1.1.5", "MAC Address": "00:1e:67:ab:cd:ff"}}`), &src.bmc))
+	src.system.Model = "S2600KPR"
+
+	inv := buildInventory("aabbccdd", src)
+
+	assert.Equal(t, "aabbccdd", inv.NodeID)
+	assert.Equal(t, "Intel Corporation", inv.Vendor)
+	assert.Equal(t, "S2600KPR", inv.Model, "Redfish should be preferred over the dmi catalog")
+	assert.Equal(t, "BQWL51200123", inv.SerialNumber)
+	assert.Equal(t, "SE5C610.86B.01.01.0016", inv.BIOSVersion)
+	assert.Equal(t, 32, inv.CPUs)
+	assert.Equal(t, "Intel(R) Xeon(R) CPU E5-2650 v2 @ 2.60GHz", inv.CPUModel)
+	assert.Equal(t, 257907, inv.MemoryMB)
+	assert.Equal(t, []inventoryDisk{
+		{Name: "sda", Model: "ST1000NM0033-9ZM", SizeGB: 1000, Rotational: true},
+		{Name: "sdb", Model: "INTEL SSDSC2BB48", SizeGB: 480, Rotational: false},
+	}, inv.Disks)
+	assert.Equal(t, []inventoryNIC{
+		{Name: "eth0", MAC: "00:1e:67:ab:cd:01", SpeedMbps: 10000, IPAddresses: []string{"172.31.128.10"}},
+		{Name: "eth1", MAC: "00:1e:67:ab:cd:02", SpeedMbps: 1000, IPAddresses: []string{}},
+	}, inv.NICs)
+	assert.Equal(t, inventoryBMC{IPAddress: "10.1.1.5", MACAddress: "00:1e:67:ab:cd:ff"}, inv.BMC)
+}
+
+func TestBuildInventoryNoSources(t *testing.T) {
+	inv := buildInventory("aabbccdd", &inventorySources{})
+
+	data, err := json.Marshal(inv)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"disks":[]`, "Empty lists should be kept in the document")
+	assert.Equal(t, 0, inv.MemoryMB)
+}
@@ -0,0 +1,159 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	modelsMonorail "github.com/codedellemc/gorackhd/models"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	engineLabelPrefix = "rackhd."
+	daemonConfigPath  = "/etc/docker/daemon.json"
+
+	diskTypeSSD   = "ssd"
+	diskTypeHDD   = "hdd"
+	diskTypeMixed = "mixed"
+)
+
+// diskType describes the drives of a node as ssd, hdd or mixed, or "" if
+// there are none.
+func diskType(disks []inventoryDisk) string {
+	ssd, hdd := false, false
+	for _, disk := range disks {
+		if disk.Rotational {
+			hdd = true
+		} else {
+			ssd = true
+		}
+	}
+	switch {
+	case ssd && hdd:
+		return diskTypeMixed
+	case ssd:
+		return diskTypeSSD
+	case hdd:
+		return diskTypeHDD
+	}
+	return ""
+}
+
+// engineLabels returns the Docker engine labels describing the hardware of
+// the node, sorted. Facts that are not known are left out.
+func engineLabels(inv *inventory, skuName, rack, enclosure string) []string {
+	values := map[string]string{
+		"node-id":   inv.NodeID,
+		"sku":       skuName,
+		"rack":      rack,
+		"enclosure": enclosure,
+		"cpu-model": inv.CPUModel,
+		"disk-type": diskType(inv.Disks),
+	}
+	if inv.CPUs > 0 {
+		values["cpus"] = strconv.Itoa(inv.CPUs)
+	}
+	if inv.MemoryMB > 0 {
+		values["memory-gb"] = strconv.Itoa(inv.MemoryMB / 1024)
+	}
+	speed := 0
+	for _, nic := range inv.NICs {
+		if nic.SpeedMbps > speed {
+			speed = nic.SpeedMbps
+		}
+	}
+	if speed > 0 {
+		values["nic-speed-mbps"] = strconv.Itoa(speed)
+	}
+
+	labels := []string{}
+	for key, value := range values {
+		if value != "" {
+			labels = append(labels, engineLabelPrefix+key+"="+value)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// getSkuName returns the name of the SKU with the given ID.
+func (d *Driver) getSkuName(client *apiclientMonorail.Monorail, skuID string) (string, error) {
+	resp, err := client.Skus.GetSkus(nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	skus := []modelsMonorail.Sku{}
+	if err := decodePayload(resp.Payload, &skus); err != nil {
+		return "", err
+	}
+	for _, sku := range skus {
+		if sku.ID == skuID {
+			return sku.Name, nil
+		}
+	}
+	return "", fmt.Errorf("No SKU found with ID %v", skuID)
+}
+
+// quoteShell quotes s for a POSIX shell.
+func quoteShell(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// applyEngineLabels writes the hardware labels of the node to the Docker
+// daemon configuration file before libmachine installs Docker. libmachine
+// passes --engine-label values as command line flags, and Docker refuses to
+// start when labels are given both ways, which is why SetConfigFromFlags
+// does not accept both. An existing daemon configuration is left alone.
+func (d *Driver) applyEngineLabels(client *apiclientMonorail.Monorail, inv *inventory) error {
+	node, err := d.getNode(client, d.NodeID)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve node %v. Error: %s", d.NodeID, err)
+	}
+
+	skuID := d.NodeSkuID
+	if skuID == "" {
+		skuID = node.Sku
+	}
+	skuName := ""
+	if skuID != "" {
+		skuName, err = d.getSkuName(client, skuID)
+		if err != nil {
+			log.Warnf("Leaving the SKU out of the engine labels. Error: %s", err)
+		}
+	}
+
+	rackTagPrefix := d.RackTagPrefix
+	if rackTagPrefix == "" {
+		rackTagPrefix = defaultRackTagPrefix
+	}
+	labels := engineLabels(inv, skuName, rackOf(*node, rackTagPrefix), enclosureOf(*node))
+
+	config, err := json.MarshalIndent(map[string][]string{"labels": labels}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// images without sudo are common when the machine logs in as root
+	sudo := "sudo "
+	if d.GetSSHUsername() == "root" {
+		sudo = ""
+	}
+
+	log.Infof("Labelling the Docker engine of node %v with %s", d.NodeID, strings.Join(labels, ", "))
+	command := fmt.Sprintf("if [ -e %[1]s ]; then echo exists; else %[3]smkdir -p /etc/docker && printf '%%s\\n' %[2]s | %[3]stee %[1]s > /dev/null; fi",
+		daemonConfigPath, quoteShell(string(config)), sudo)
+	out, err := drivers.RunSSHCommandFromDriver(d, command)
+	if err != nil {
+		return fmt.Errorf("Unable to write the engine labels to %s on node %v. Error: %s", daemonConfigPath, d.NodeID, err)
+	}
+	if strings.TrimSpace(out) == "exists" {
+		log.Warnf("Node %v already has a %s, the engine labels have not been added to it", d.NodeID, daemonConfigPath)
+	}
+	return nil
+}
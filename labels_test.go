@@ -0,0 +1,44 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskType(t *testing.T) {
+	assert.Equal(t, "ssd", diskType([]inventoryDisk{{Name: "sda"}, {Name: "sdb"}}))
+	assert.Equal(t, "hdd", diskType([]inventoryDisk{{Name: "sda", Rotational: true}}))
+	assert.Equal(t, "mixed", diskType([]inventoryDisk{{Name: "sda", Rotational: true}, {Name: "sdb"}}))
+	assert.Equal(t, "", diskType(nil))
+}
+
+func TestEngineLabels(t *testing.T) {
+	inv := &inventory{
+		NodeID:   "aabbccdd",
+		CPUs:     32,
+		CPUModel: "Intel(R) Xeon(R) CPU E5-2650 v2 @ 2.60GHz",
+		MemoryMB: 257907,
+		Disks:    []inventoryDisk{{Name: "sda"}},
+		NICs:     []inventoryNIC{{Name: "eth0", SpeedMbps: 1000}, {Name: "eth1", SpeedMbps: 10000}},
+	}
+
+	assert.Equal(t, []string{
+		"rackhd.cpu-model=Intel(R) Xeon(R) CPU E5-2650 v2 @ 2.60GHz",
+		"rackhd.cpus=32",
+		"rackhd.disk-type=ssd",
+		"rackhd.enclosure=58c9b2ac8b2ba9aa3e6cfa50",
+		"rackhd.memory-gb=251",
+		"rackhd.nic-speed-mbps=10000",
+		"rackhd.node-id=aabbccdd",
+		"rackhd.rack=R12",
+		"rackhd.sku=LargeNode",
+	}, engineLabels(inv, "LargeNode", "R12", "58c9b2ac8b2ba9aa3e6cfa50"))
+
+	assert.Equal(t, []string{"rackhd.node-id=aabbccdd"}, engineLabels(&inventory{NodeID: "aabbccdd"}, "", "", ""), "Unknown facts should be left out")
+}
+
+func TestQuoteShell(t *testing.T) {
+	assert.Equal(t, `'{"labels": ["a=b"]}'`, quoteShell(`{"labels": ["a=b"]}`))
+	assert.Equal(t, `'it'\''s'`, quoteShell("it's"))
+}
@@ -0,0 +1,90 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/codedellemc/gorackhd/client/lookups"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// RackHD node IDs are MongoDB ObjectIDs
+var nodeIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+
+// lookupEntry is one record of the RackHD lookups table, which maps the MAC
+// and IP addresses seen by DHCP to nodes.
+type lookupEntry struct {
+	ID         string `json:"id"`
+	Node       string `json:"node"`
+	MacAddress string `json:"macAddress"`
+	IPAddress  string `json:"ipAddress"`
+}
+
+// decodePayload converts an untyped API payload into out by round-tripping
+// it through JSON.
+func decodePayload(payload interface{}, out interface{}) error {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, out)
+}
+
+// resolveNodeID replaces a MAC or IP address given as --rackhd-node-id with
+// the ID of the node it belongs to, so that every later API call and the
+// stored driver config use the canonical ID.
+func (d *Driver) resolveNodeID(client *apiclientMonorail.Monorail) error {
+	if nodeIDPattern.MatchString(d.NodeID) {
+		return nil
+	}
+
+	query := d.NodeID
+	if mac, err := net.ParseMAC(query); err == nil {
+		query = mac.String()
+	} else if net.ParseIP(query) == nil {
+		return fmt.Errorf("Node ID %q is not a node ID, MAC address or IP address", d.NodeID)
+	}
+
+	log.Debugf("Looking up node by address: %v", query)
+	resp, err := client.Lookups.GetLookups(&lookups.GetLookupsParams{Q: &query}, nil)
+	if err != nil {
+		return err
+	}
+
+	entries := []lookupEntry{}
+	if err := decodePayload(resp.Payload, &entries); err != nil {
+		return err
+	}
+
+	nodeIDs := nodesMatchingAddress(entries, query)
+	switch len(nodeIDs) {
+	case 0:
+		return fmt.Errorf("No node found with address %v. Check that the node has been discovered by RackHD", d.NodeID)
+	case 1:
+		log.Infof("Resolved %v to Node ID: %v", d.NodeID, nodeIDs[0])
+		d.NodeID = nodeIDs[0]
+		return nil
+	default:
+		return fmt.Errorf("Address %v matches more than one node (%s). Specify the Node ID instead", d.NodeID, strings.Join(nodeIDs, ", "))
+	}
+}
+
+// nodesMatchingAddress returns the distinct node IDs of the lookup entries
+// whose MAC or IP address equals addr. The lookups API matches queries
+// loosely, so its results are filtered here.
+func nodesMatchingAddress(entries []lookupEntry, addr string) []string {
+	nodeIDs := []string{}
+	for _, entry := range entries {
+		if !strings.EqualFold(entry.MacAddress, addr) && entry.IPAddress != addr {
+			continue
+		}
+		if entry.Node != "" && !stringInSlice(entry.Node, nodeIDs) {
+			nodeIDs = append(nodeIDs, entry.Node)
+		}
+	}
+	return nodeIDs
+}
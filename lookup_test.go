@@ -0,0 +1,24 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodesMatchingAddress(t *testing.T) {
+	entries := []lookupEntry{
+		{Node: "57bdf3197ca543010074684b", MacAddress: "08:00:27:e8:1e:a2", IPAddress: "172.31.128.5"},
+		{Node: "57bdf3197ca543010074684b", MacAddress: "08:00:27:e8:1e:a3", IPAddress: "172.31.128.50"},
+		{Node: "57bdf3197ca543010074684c", MacAddress: "08:00:27:aa:bb:cc", IPAddress: "172.31.128.6"},
+		{MacAddress: "08:00:27:aa:bb:dd", IPAddress: "172.31.128.7"},
+	}
+
+	assert.Equal(t, []string{"57bdf3197ca543010074684b"}, nodesMatchingAddress(entries, "172.31.128.5"))
+	assert.Equal(t, []string{"57bdf3197ca543010074684b"}, nodesMatchingAddress(entries, "08:00:27:E8:1E:A3"))
+	assert.Empty(t, nodesMatchingAddress(entries, "172.31.128.7"), "Entries without a node should be ignored")
+	assert.Empty(t, nodesMatchingAddress(entries, "172.31.128.9"))
+
+	entries = append(entries, lookupEntry{Node: "57bdf3197ca543010074684d", IPAddress: "172.31.128.6"})
+	assert.Len(t, nodesMatchingAddress(entries, "172.31.128.6"), 2)
+}
@@ -0,0 +1,144 @@
+package rackhd
+
+import (
+	"fmt"
+	"time"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/codedellemc/gorackhd/client/nodes"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// reservationTag marks nodes that have been claimed by a machine
+	reservationTag = "dockermachine"
+
+	nodeTypeCompute = "compute"
+)
+
+// rackhdNode holds the fields of a Monorail node the driver relies on.
+type rackhdNode struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Tags      []string       `json:"tags"`
+	Sku       string         `json:"sku"`
+	Relations []nodeRelation `json:"relations"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+// nodeWorkflow is a workflow (graph) instance that has run or is running on
+// a node.
+type nodeWorkflow struct {
+	InstanceID string `json:"instanceId"`
+	Name       string `json:"injectableName"`
+	Status     string `json:"_status"`
+}
+
+func (d *Driver) getNode(client *apiclientMonorail.Monorail, nodeID string) (*rackhdNode, error) {
+	resp, err := client.Nodes.GetNodesIdentifier(&nodes.GetNodesIdentifierParams{Identifier: nodeID}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &rackhdNode{}
+	if err := decodePayload(resp.Payload, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// getActiveWorkflow returns the workflow currently running on the node, or
+// nil if the node is idle. RackHD answers without a workflow then, so the
+// instance ID is what tells the two apart.
+func (d *Driver) getActiveWorkflow(client *apiclientMonorail.Monorail, nodeID string) (*nodeWorkflow, error) {
+	params := nodes.NewGetNodesIdentifierWorkflowsActiveParams()
+	params.WithIdentifier(nodeID)
+	resp, err := client.Nodes.GetNodesIdentifierWorkflowsActive(params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	wf := &nodeWorkflow{}
+	if err := decodePayload(resp.Payload, wf); err != nil {
+		return nil, err
+	}
+	if wf.InstanceID == "" {
+		return nil, nil
+	}
+	return wf, nil
+}
+
+// checkNode verifies that the node given with --rackhd-node-id can become a
+// Docker host. The OBM settings from --rackhd-obm-host are only written once
+// the node is known to be free, so that the BMC credentials of a node held
+// by another machine are never touched.
+func (d *Driver) checkNode(client *apiclientMonorail.Monorail) error {
+	log.Debugf("Checking that node %v is usable", d.NodeID)
+
+	node, err := d.getNode(client, d.NodeID)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve node %v. Error: %s", d.NodeID, err)
+	}
+
+	if reservationExpired(*node, d.ReservationTTL, time.Now()) {
+		err = d.reclaimNode(client, node)
+		if err != nil {
+			return err
+		}
+		node, err = d.getNode(client, d.NodeID)
+		if err != nil {
+			return fmt.Errorf("Unable to retrieve node %v. Error: %s", d.NodeID, err)
+		}
+	}
+
+	activeWorkflow, err := d.getActiveWorkflow(client, d.NodeID)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve workflows of node %v. Error: %s", d.NodeID, err)
+	}
+
+	err = validateNode(node, activeWorkflow)
+	if err != nil {
+		return err
+	}
+
+	if d.ObmHost != "" {
+		err = d.configureObm(client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !d.RequireObm {
+		return nil
+	}
+	obms, err := d.getObms(client, d.NodeID)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve OBM settings of node %v. Error: %s", d.NodeID, err)
+	}
+	return validateNodeObm(node, obms, d.ObmService)
+}
+
+// validateNode returns an error describing the first reason the node cannot
+// be used for a new machine.
+func validateNode(node *rackhdNode, activeWorkflow *nodeWorkflow) error {
+	if node.Type != nodeTypeCompute {
+		return fmt.Errorf("Node %v is of type %q. Only compute nodes can be used, specify the ID of a compute node rather than an enclosure or switch", node.ID, node.Type)
+	}
+	if stringInSlice(reservationTag, node.Tags) {
+		return fmt.Errorf("Node %v is already claimed by another machine (tagged %q). Remove that machine, or use --rackhd-reservation-ttl to reclaim stale claims", node.ID, reservationTag)
+	}
+	if activeWorkflow != nil {
+		return fmt.Errorf("Node %v is busy running workflow %v (instance %v). Wait for it to finish or cancel it in RackHD", node.ID, activeWorkflow.Name, activeWorkflow.InstanceID)
+	}
+	return nil
+}
+
+// validateNodeObm checks for --rackhd-require-obm that the OBM chooseObm
+// picks from obms can control the power of the node.
+func validateNodeObm(node *rackhdNode, obms []nodeObm, obmService string) error {
+	if !hasPowerObm(obms, obmService) {
+		return fmt.Errorf("Node %v has no OBM settings that can control its power, so start, stop, restart and kill will not work. Configure an OBM for the node in RackHD or omit --rackhd-require-obm", node.ID)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNode(t *testing.T) {
+	node := &rackhdNode{ID: "57bdf3197ca543010074684b", Type: "compute", Tags: []string{"rack:r1"}}
+	ipmi := []nodeObm{{Service: "ipmi-obm-service"}}
+	noop := []nodeObm{{Service: noopObmService}}
+	assert.NoError(t, validateNode(node, nil))
+	assert.NoError(t, validateNodeObm(node, ipmi, ""))
+
+	assert.Error(t, validateNodeObm(node, nil, ""), "Should error if an OBM is required but missing")
+	assert.Error(t, validateNodeObm(node, noop, ""), "Should error if the only OBM is noop, it cannot control power")
+	assert.Error(t, validateNodeObm(node, ipmi, "redfish-obm-service"), "Should error if the preferred OBM is missing")
+	assert.Error(t, validateNode(node, &nodeWorkflow{Name: "Graph.Discovery", Status: "running"}), "Should error if a workflow is active")
+
+	enclosure := &rackhdNode{ID: "57bdf3197ca543010074684c", Type: "enclosure"}
+	assert.Error(t, validateNode(enclosure, nil), "Should error on enclosure nodes")
+
+	claimed := &rackhdNode{ID: "57bdf3197ca543010074684d", Type: "compute", Tags: []string{reservationTag}}
+	assert.Error(t, validateNode(claimed, nil), "Should error on nodes claimed by another machine")
+}
@@ -0,0 +1,169 @@
+package rackhd
+
+import (
+	"errors"
+	"fmt"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/codedellemc/gorackhd/client/nodes"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	noopObmService    = "noop-obm-service"
+	defaultObmService = "ipmi-obm-service"
+)
+
+// obmPriority is the order in which OBM services are preferred when a node
+// has several and --rackhd-obm-service is not given. Services not listed
+// come after these, and the noop service, which cannot control power, last.
+var obmPriority = []string{
+	"ipmi-obm-service",
+	"redfish-obm-service",
+	"amt-obm-service",
+	"apc-obm-service",
+	"raritan-obm-service",
+	"servertech-obm-service",
+	"panduit-obm-service",
+	"snmp-obm-service",
+	"vbox-obm-service",
+	"vmrun-obm-service",
+}
+
+var (
+	errNoopObm = errors.New(noopObmService)
+	errNoObm   = errors.New("No OBM Detected")
+)
+
+// nodeObm is one set of OBM settings of a node. Config holds the settings of
+// the service, such as the host, user and password of an IPMI BMC.
+type nodeObm struct {
+	Service string                 `json:"service"`
+	Config  map[string]interface{} `json:"config"`
+}
+
+// configString returns a string setting of the OBM, or "" if it is missing.
+func (o *nodeObm) configString(key string) string {
+	if val, ok := o.Config[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+// controlsPower reports whether the OBM can power the node on and off. The
+// noop service, used for nodes such as Vagrant boxes, cannot.
+func (o *nodeObm) controlsPower() bool {
+	return o.Service != noopObmService
+}
+
+// hasPowerObm reports whether the OBM chooseObm picks for the node can
+// control its power, which start, stop, restart and kill depend on.
+func hasPowerObm(obms []nodeObm, preferred string) bool {
+	obm := chooseObm(obms, preferred)
+	return obm != nil && obm.controlsPower()
+}
+
+func (d *Driver) getObms(client *apiclientMonorail.Monorail, nodeID string) ([]nodeObm, error) {
+	respObm, err := client.Nodes.GetNodesIdentifierObm(&nodes.GetNodesIdentifierObmParams{Identifier: nodeID}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	obms := []nodeObm{}
+	if err := decodePayload(respObm.Payload, &obms); err != nil {
+		return nil, fmt.Errorf("Unable to parse OBM settings of node %v. Error: %s", nodeID, err)
+	}
+	return obms, nil
+}
+
+// chooseObm returns the OBM named preferred, or when preferred is "" the
+// highest priority OBM of the node. It returns nil if there is no match.
+func chooseObm(obms []nodeObm, preferred string) *nodeObm {
+	if preferred != "" {
+		for i := range obms {
+			if obms[i].Service == preferred {
+				return &obms[i]
+			}
+		}
+		return nil
+	}
+
+	rank := func(obm *nodeObm) int {
+		if !obm.controlsPower() {
+			return len(obmPriority) + 1
+		}
+		for i, s := range obmPriority {
+			if s == obm.Service {
+				return i
+			}
+		}
+		return len(obmPriority)
+	}
+
+	var chosen *nodeObm
+	for i := range obms {
+		if chosen == nil || rank(&obms[i]) < rank(chosen) {
+			chosen = &obms[i]
+		}
+	}
+	return chosen
+}
+
+// getObm returns the OBM the driver uses for the node. It returns errNoObm
+// if the node has none.
+func (d *Driver) getObm(client *apiclientMonorail.Monorail) (*nodeObm, error) {
+	obms, err := d.getObms(client, d.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(obms) == 0 {
+		return nil, errNoObm
+	}
+
+	obm := chooseObm(obms, d.ObmService)
+	if obm == nil {
+		return nil, fmt.Errorf("OBM service %s is not configured for node %v", d.ObmService, d.NodeID)
+	}
+	log.Debugf("Using OBM service %s of node %v", obm.Service, d.NodeID)
+	return obm, nil
+}
+
+// validateObmSettings checks the OBM credential options. The BMC address
+// belongs to one node, so it can only be given together with a Node ID.
+func validateObmSettings(host, user, password, nodeID string) error {
+	if host == "" {
+		if user != "" || password != "" {
+			return fmt.Errorf("--rackhd-obm-user and --rackhd-obm-password require --rackhd-obm-host")
+		}
+		return nil
+	}
+	if nodeID == "" {
+		return fmt.Errorf("--rackhd-obm-host requires --rackhd-node-id, the BMC address belongs to a single node")
+	}
+	return nil
+}
+
+// configureObm creates or replaces the settings of the --rackhd-obm-service
+// OBM of the node from the --rackhd-obm-* options, so that the life cycle
+// functions work on nodes that were just discovered. Only that service is
+// sent, and only with the credentials given to the driver: the settings
+// RackHD returns hold redacted passwords, which must not be written back.
+func (d *Driver) configureObm(client *apiclientMonorail.Monorail) error {
+	config := map[string]interface{}{"host": d.ObmHost}
+	if d.ObmUser != "" {
+		config["user"] = d.ObmUser
+	}
+	if d.ObmPassword != "" {
+		config["password"] = d.ObmPassword
+	}
+
+	log.Infof("Configuring OBM service %s of node %v for BMC %v", d.ObmService, d.NodeID, d.ObmHost)
+	params := nodes.NewPostNodesIdentifierObmParams()
+	params.WithIdentifier(d.NodeID)
+	params.WithObm(nodeObm{Service: d.ObmService, Config: config})
+	_, err := client.Nodes.PostNodesIdentifierObm(params, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to configure OBM settings of node %v. Error: %s", d.NodeID, err)
+	}
+	return nil
+}
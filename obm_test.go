@@ -0,0 +1,46 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseObm(t *testing.T) {
+	obms := []nodeObm{
+		{Service: noopObmService},
+		{Service: "vendor-obm-service"},
+		{Service: "ipmi-obm-service", Config: map[string]interface{}{"host": "10.1.1.5", "user": "admin"}},
+	}
+
+	obm := chooseObm(obms, "")
+	assert.Equal(t, "ipmi-obm-service", obm.Service)
+	assert.Equal(t, "10.1.1.5", obm.configString("host"))
+	assert.Equal(t, "", obm.configString("password"))
+
+	assert.Equal(t, "vendor-obm-service", chooseObm(obms[:2], "").Service, "Unknown services should be preferred over noop")
+	assert.Equal(t, noopObmService, chooseObm(obms[:1], "").Service)
+	assert.Equal(t, "vendor-obm-service", chooseObm(obms, "vendor-obm-service").Service)
+
+	assert.Nil(t, chooseObm(obms, "amt-obm-service"))
+	assert.Nil(t, chooseObm(nil, ""))
+}
+
+func TestHasPowerObm(t *testing.T) {
+	noop := []nodeObm{{Service: noopObmService}}
+	assert.False(t, hasPowerObm(noop, ""), "A noop OBM cannot control power")
+	assert.False(t, hasPowerObm(noop, noopObmService))
+	assert.False(t, hasPowerObm(nil, ""))
+
+	obms := append(noop, nodeObm{Service: "ipmi-obm-service"})
+	assert.True(t, hasPowerObm(obms, ""))
+	assert.True(t, hasPowerObm(obms, "ipmi-obm-service"))
+	assert.False(t, hasPowerObm(obms, "redfish-obm-service"))
+}
+
+func TestValidateObmSettings(t *testing.T) {
+	assert.NoError(t, validateObmSettings("", "", "", ""))
+	assert.NoError(t, validateObmSettings("10.1.1.5", "admin", "secret", "aabbccdd"))
+	assert.Error(t, validateObmSettings("", "admin", "", "aabbccdd"), "Credentials without a host should be rejected")
+	assert.Error(t, validateObmSettings("10.1.1.5", "admin", "secret", ""), "A BMC host without a Node ID should be rejected")
+}
@@ -0,0 +1,109 @@
+package rackhd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	placementSpread = "spread"
+	placementPack   = "pack"
+
+	// groupTagPrefix is followed by the placement group of the machine
+	// that reserved the node
+	groupTagPrefix = "dockermachine-group:"
+
+	defaultRackTagPrefix = "rack:"
+
+	relationEnclosedBy = "enclosedBy"
+)
+
+// nodeRelation is one entry of a node's relations, such as the enclosure
+// that contains a compute node.
+type nodeRelation struct {
+	RelationType string   `json:"relationType"`
+	Targets      []string `json:"targets"`
+}
+
+func validatePlacement(policy string) error {
+	switch policy {
+	case "", placementSpread, placementPack:
+		return nil
+	}
+	return fmt.Errorf("Unsupported placement policy %q. Specify spread or pack", policy)
+}
+
+func groupTag(group string) string {
+	return groupTagPrefix + group
+}
+
+// rackOf returns the rack a node is tagged with, or "" if it has no rack tag.
+func rackOf(node rackhdNode, rackTagPrefix string) string {
+	for _, tag := range node.Tags {
+		if strings.HasPrefix(tag, rackTagPrefix) {
+			return strings.TrimPrefix(tag, rackTagPrefix)
+		}
+	}
+	return ""
+}
+
+// enclosureOf returns the ID of the enclosure containing a node, or "" if
+// RackHD does not know of one.
+func enclosureOf(node rackhdNode) string {
+	for _, relation := range node.Relations {
+		if relation.RelationType == relationEnclosedBy && len(relation.Targets) > 0 {
+			return relation.Targets[0]
+		}
+	}
+	return ""
+}
+
+// placeNodes narrows candidates down to the nodes that best satisfy the
+// placement policy for the group. The nodes reserved for the same group are
+// counted per rack and per enclosure; spread prefers the candidates whose
+// rack, then enclosure, hold the fewest of them and pack the most. Without a
+// policy or group all candidates are returned.
+func placeNodes(policy, group, rackTagPrefix string, candidates, nodes []rackhdNode) []rackhdNode {
+	if policy == "" || group == "" || len(candidates) == 0 {
+		return candidates
+	}
+
+	perRack := map[string]int{}
+	perEnclosure := map[string]int{}
+	for _, node := range nodes {
+		if !stringInSlice(reservationTag, node.Tags) || !stringInSlice(groupTag(group), node.Tags) {
+			continue
+		}
+		if rack := rackOf(node, rackTagPrefix); rack != "" {
+			perRack[rack]++
+		}
+		if enclosure := enclosureOf(node); enclosure != "" {
+			perEnclosure[enclosure]++
+		}
+	}
+
+	// score is compared rack count first, enclosure count second
+	score := func(node rackhdNode) [2]int {
+		return [2]int{perRack[rackOf(node, rackTagPrefix)], perEnclosure[enclosureOf(node)]}
+	}
+	better := func(a, b [2]int) bool {
+		if policy == placementPack {
+			a, b = b, a
+		}
+		return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+	}
+
+	best := []rackhdNode{candidates[0]}
+	bestScore := score(candidates[0])
+	for _, node := range candidates[1:] {
+		s := score(node)
+		switch {
+		case better(s, bestScore):
+			best = []rackhdNode{node}
+			bestScore = s
+		case s == bestScore:
+			best = append(best, node)
+		}
+	}
+	return best
+}
@@ -0,0 +1,69 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func placementNode(id, rack, enclosure string, tags ...string) rackhdNode {
+	node := rackhdNode{ID: id, Type: "compute", Tags: tags}
+	if rack != "" {
+		node.Tags = append(node.Tags, defaultRackTagPrefix+rack)
+	}
+	if enclosure != "" {
+		node.Relations = []nodeRelation{{RelationType: relationEnclosedBy, Targets: []string{enclosure}}}
+	}
+	return node
+}
+
+func nodeIDs(nodes []rackhdNode) []string {
+	ids := []string{}
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+func TestPlaceNodes(t *testing.T) {
+	reserved := []string{reservationTag, groupTag("swarm")}
+	pool := []rackhdNode{
+		placementNode("a1", "r1", "e1", reserved...),
+		placementNode("a2", "r1", "e2", reserved...),
+		placementNode("b1", "r2", "e3", reserved...),
+		placementNode("b2", "r2", "e3", reservationTag, groupTag("other")),
+		placementNode("a3", "r1", "e1"),
+		placementNode("a4", "r1", "e2"),
+		placementNode("b3", "r2", "e3"),
+		placementNode("b4", "r2", "e4"),
+	}
+	candidates := pool[4:]
+
+	assert.Equal(t, []string{"b4"}, nodeIDs(placeNodes(placementSpread, "swarm", defaultRackTagPrefix, candidates, pool)))
+	assert.Equal(t, []string{"a3", "a4"}, nodeIDs(placeNodes(placementPack, "swarm", defaultRackTagPrefix, candidates, pool)))
+	assert.Equal(t, nodeIDs(candidates), nodeIDs(placeNodes("", "swarm", defaultRackTagPrefix, candidates, pool)))
+	assert.Equal(t, nodeIDs(candidates), nodeIDs(placeNodes(placementSpread, "", defaultRackTagPrefix, candidates, pool)))
+}
+
+func TestPlaceNodesAcrossSkus(t *testing.T) {
+	// the group already runs in rack r1 on nodes of a preferred SKU that is
+	// now exhausted
+	preferred := []rackhdNode{
+		placementNode("a1", "r1", "e1", reservationTag, groupTag("swarm")),
+	}
+	fallback := []rackhdNode{
+		placementNode("c1", "r1", "e5"),
+		placementNode("c2", "r2", "e6"),
+	}
+	allNodes := append(append([]rackhdNode{}, preferred...), fallback...)
+
+	assert.Equal(t, []string{"c2"}, nodeIDs(placeNodes(placementSpread, "swarm", defaultRackTagPrefix, fallback, allNodes)))
+	assert.Equal(t, []string{"c1"}, nodeIDs(placeNodes(placementPack, "swarm", defaultRackTagPrefix, fallback, allNodes)))
+}
+
+func TestValidatePlacement(t *testing.T) {
+	assert.NoError(t, validatePlacement(""))
+	assert.NoError(t, validatePlacement("spread"))
+	assert.NoError(t, validatePlacement("pack"))
+	assert.Error(t, validatePlacement("random"))
+}
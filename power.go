@@ -0,0 +1,273 @@
+package rackhd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codedellemc/gorackhd-redfish/client/redfish_v1"
+	modelsRedfish "github.com/codedellemc/gorackhd-redfish/models"
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	powerAPIMonorail = "monorail"
+	powerAPIRedfish  = "redfish"
+
+	defaultPowerAPI         = powerAPIMonorail
+	defaultPowerTimeoutMins = 1
+	defaultPowerPollSecs    = 10
+
+	// ways of asking the OS to shut down before the power is cut
+	gracefulStopSSH  = "ssh"
+	gracefulStopACPI = "acpi"
+	gracefulStopNone = "none"
+
+	defaultGracefulStop     = gracefulStopSSH
+	defaultStopGracePeriod  = 120
+	gracefulStopPollSecs    = 5
+	gracefulShutdownCommand = "sudo shutdown -h now"
+)
+
+// Power actions the driver performs on a node through its OBM
+const (
+	powerOn     = "on"
+	powerOff    = "off"
+	powerReboot = "reboot"
+)
+
+// Redfish ComputerSystem.Reset types
+const (
+	resetOn               = "On"
+	resetForceOff         = "ForceOff"
+	resetGracefulShutdown = "GracefulShutdown"
+	resetGracefulRestart  = "GracefulRestart"
+	resetForceRestart     = "ForceRestart"
+)
+
+// Default Monorail graphs implementing each power action
+var powerGraphs = map[string]string{
+	powerOn:     "Graph.PowerOn.Node",
+	powerOff:    "Graph.PowerOff.Node",
+	powerReboot: "Graph.Reboot.Node",
+}
+
+// Redfish reset type implementing each power action and the power state the
+// system reports once it is done. A reboot has no such state: the system is
+// already On before a ForceRestart, so Restart relies on waitForSSH instead.
+var (
+	powerResetTypes = map[string]string{
+		powerOn:     resetOn,
+		powerOff:    resetForceOff,
+		powerReboot: resetForceRestart,
+	}
+	powerStates = map[string]string{
+		powerOn:  "On",
+		powerOff: "Off",
+	}
+)
+
+func validateGracefulStop(method string) error {
+	switch method {
+	case gracefulStopSSH, gracefulStopACPI, gracefulStopNone:
+		return nil
+	}
+	return fmt.Errorf("Unsupported graceful stop method %q. Specify ssh, acpi or none", method)
+}
+
+func validatePowerAPI(api string) error {
+	switch api {
+	case powerAPIMonorail, powerAPIRedfish:
+		return nil
+	}
+	return fmt.Errorf("Unsupported power API %q. Specify monorail or redfish", api)
+}
+
+// powerGraph returns the Monorail graph that performs the power action,
+// which may have been overridden to use a vendor specific graph.
+func (d *Driver) powerGraph(action string) string {
+	graph := ""
+	switch action {
+	case powerOn:
+		graph = d.PowerOnGraph
+	case powerOff:
+		graph = d.PowerOffGraph
+	case powerReboot:
+		graph = d.RebootGraph
+	}
+	if graph == "" {
+		graph = powerGraphs[action]
+	}
+	return graph
+}
+
+// powerTimeouts returns how long, in minutes, to wait for a power action to
+// finish and how often, in seconds, to check on it. Machines created before
+// these were configurable get the defaults.
+func (d *Driver) powerTimeouts() (int, int) {
+	timeoutMins, pollSecs := d.PowerTimeout, d.PowerPollInterval
+	if timeoutMins <= 0 {
+		timeoutMins = defaultPowerTimeoutMins
+	}
+	if pollSecs <= 0 {
+		pollSecs = defaultPowerPollSecs
+	}
+	return timeoutMins, pollSecs
+}
+
+// runPowerAction performs the power action with a Monorail graph or, when
+// --rackhd-power-api is redfish, a Redfish ComputerSystem.Reset.
+func (d *Driver) runPowerAction(clientMonorail *apiclientMonorail.Monorail, action string) error {
+	timeoutMins, pollSecs := d.powerTimeouts()
+
+	if d.PowerAPI == powerAPIRedfish {
+		return d.redfishReset(powerResetTypes[action], powerStates[action],
+			time.Duration(timeoutMins)*time.Minute, time.Duration(pollSecs)*time.Second)
+	}
+
+	graph := d.powerGraph(action)
+	wfInstance, err := d.applyWorkflow(clientMonorail, graph, nil)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Workflow %s applied as instance id %s", graph, wfInstance)
+	return d.waitForWorkflow(clientMonorail, wfInstance, timeoutMins, pollSecs)
+}
+
+// redfishReset sends a ComputerSystem.Reset of the given type and waits for
+// the system to report the expected power state, if there is one.
+func (d *Driver) redfishReset(resetType, wantState string, timeout, poll time.Duration) error {
+	clientRedfish := d.getClientRedfish()
+
+	log.Debugf("Sending Redfish %s reset to: %#v", resetType, d.NodeID)
+	params := redfish_v1.NewDoResetParams()
+	params.WithIdentifier(d.NodeID)
+	params.WithPayload(&modelsRedfish.RackHDResetActionResetAction{ResetType: resetType})
+	if _, err := clientRedfish.RedfishV1.DoReset(params); err != nil {
+		return fmt.Errorf("Redfish %s reset failed. Error: %s", resetType, err)
+	}
+
+	if wantState == "" {
+		log.Debugf("Redfish %s reset of %#v sent, not waiting for a power state", resetType, d.NodeID)
+		return nil
+	}
+	return d.waitForPowerState(wantState, timeout, poll)
+}
+
+// getPowerState returns the power state Redfish reports for the node.
+func (d *Driver) getPowerState() (string, error) {
+	clientRedfish := d.getClientRedfish()
+	resp, err := clientRedfish.RedfishV1.GetSystem(&redfish_v1.GetSystemParams{Identifier: d.NodeID})
+	if err != nil {
+		return "", err
+	}
+	return resp.Payload.PowerState, nil
+}
+
+func (d *Driver) waitForPowerState(wantState string, timeout, poll time.Duration) error {
+	expired := time.After(timeout)
+	tick := time.Tick(poll)
+	log.Debugf("Waiting up to %v for power state %v", timeout, wantState)
+	for {
+		select {
+		case <-expired:
+			return fmt.Errorf("Timeout waiting for power state %v", wantState)
+		case <-tick:
+			powerState, err := d.getPowerState()
+			if err != nil {
+				return err
+			}
+			log.Debugf("Power state of %v is %v", d.NodeID, powerState)
+			if strings.EqualFold(powerState, wantState) {
+				return nil
+			}
+		}
+	}
+}
+
+// stopTimings returns how long a graceful stop waits for the power to go off
+// and how often it checks. Machines created before the grace period was
+// configurable get the default, rather than no grace period at all.
+func (d *Driver) stopTimings() (time.Duration, time.Duration) {
+	gracePeriodSecs := d.StopGracePeriod
+	if gracePeriodSecs <= 0 {
+		gracePeriodSecs = defaultStopGracePeriod
+	}
+	return time.Duration(gracePeriodSecs) * time.Second, time.Duration(gracefulStopPollSecs) * time.Second
+}
+
+// restart reboots the node. Over Redfish the OS is first asked to reboot
+// itself, unless --rackhd-graceful-stop is none, and the node is only reset
+// if it has not gone down by the end of the grace period.
+func (d *Driver) restart(clientMonorail *apiclientMonorail.Monorail) error {
+	if d.PowerAPI == powerAPIRedfish && d.GracefulStop != gracefulStopNone {
+		log.Debugf("Attempting Graceful Restart of: %#v", d.NodeID)
+		err := d.gracefulRestart()
+		if err == nil {
+			return nil
+		}
+		log.Infof("Graceful Restart did not complete (%s), forcing Restart of: %#v", err, d.NodeID)
+	}
+	return d.runPowerAction(clientMonorail, powerReboot)
+}
+
+// gracefulRestart asks the OS to reboot with a Redfish GracefulRestart and
+// waits up to the grace period for SSH to stop answering. The power state
+// stays On throughout, so the SSH port going away is the only sign that the
+// reboot has started.
+func (d *Driver) gracefulRestart() error {
+	gracePeriod, poll := d.stopTimings()
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(d.getSSHPort()))
+
+	if err := d.redfishReset(resetGracefulRestart, "", gracePeriod, poll); err != nil {
+		return err
+	}
+
+	expired := time.After(gracePeriod)
+	tick := time.Tick(poll)
+	log.Debugf("Waiting up to %v for %v to go down", gracePeriod, addr)
+	for {
+		select {
+		case <-expired:
+			return fmt.Errorf("Timeout waiting for %v to go down", addr)
+		case <-tick:
+			if !d.probePort(addr, healthCheckTimeoutSecs*time.Second) {
+				return nil
+			}
+		}
+	}
+}
+
+// gracefulStop asks the OS to shut down, over SSH or with an ACPI soft-off
+// through Redfish, and waits up to the grace period for the power to go off.
+func (d *Driver) gracefulStop() error {
+	gracePeriod, poll := d.stopTimings()
+
+	switch d.GracefulStop {
+	case gracefulStopACPI:
+		log.Debugf("Attempting ACPI soft-off of: %#v", d.NodeID)
+		return d.redfishReset(resetGracefulShutdown, powerStates[powerOff], gracePeriod, poll)
+	case gracefulStopNone:
+		return fmt.Errorf("graceful stop disabled")
+	default:
+		if d.IPAddress == "" {
+			return fmt.Errorf("IP address is not set")
+		}
+		log.Debugf("Attempting OS shutdown of: %#v", d.NodeID)
+		// the connection is usually dropped by the shutdown itself, so an
+		// error here does not mean the shutdown failed
+		if _, err := drivers.RunSSHCommandFromDriver(d, gracefulShutdownCommand); err != nil {
+			log.Debugf("Shutdown command returned: %s", err)
+		}
+		return d.waitForPowerState(powerStates[powerOff], gracePeriod, poll)
+	}
+}
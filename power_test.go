@@ -0,0 +1,29 @@
+package rackhd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopTimings(t *testing.T) {
+	// the plugin fills a zero-valued driver from the saved configuration,
+	// so machines created before the grace period existed have none set
+	d := new(Driver)
+
+	gracePeriod, poll := d.stopTimings()
+	assert.Equal(t, defaultStopGracePeriod*time.Second, gracePeriod, "A missing grace period should fall back to the default")
+	assert.Equal(t, gracefulStopPollSecs*time.Second, poll)
+	assert.True(t, gracePeriod > poll, "The power state should be checked at least once before giving up")
+
+	d.StopGracePeriod = 30
+	gracePeriod, _ = d.stopTimings()
+	assert.Equal(t, 30*time.Second, gracePeriod)
+}
+
+func TestPowerTimeouts(t *testing.T) {
+	timeoutMins, pollSecs := new(Driver).powerTimeouts()
+	assert.Equal(t, defaultPowerTimeoutMins, timeoutMins)
+	assert.Equal(t, defaultPowerPollSecs, pollSecs)
+}
@@ -9,10 +9,11 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	apiclientRedfish "github.com/codedellemc/gorackhd-redfish/client"
-	"github.com/codedellemc/gorackhd-redfish/client/redfish_v1"
 	apiclientMonorail "github.com/codedellemc/gorackhd/client"
 	"github.com/codedellemc/gorackhd/client/lookups"
 	"github.com/codedellemc/gorackhd/client/nodes"
@@ -26,37 +27,88 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
-	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 
 	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 type Driver struct {
 	*drivers.BaseDriver
-	Endpoint       string
-	NodeID         string
-	SkuID          string
-	SkuName        string
-	WorkflowName   string
-	SSHPassword    string
-	Transport      string
-	WFPollInterval int
-	WFTimeout      int
-	SSHAttempts    int
-	SSHTimeout     int
-	clientMonorail *apiclientMonorail.Monorail
-	clientRedfish  *apiclientRedfish.Redfish
+	Endpoint           string
+	NodeID             string
+	SkuID              string
+	SkuName            string
+	NodeSkuID          string
+	WorkflowName       string
+	SSHPassword        string
+	SSHBootstrapKey    string
+	SSHKeyType         string
+	SSHKeyBits         int
+	SSHBastion         string
+	SSHBastionUser     string
+	SSHBastionKey      string
+	EnginePort         int
+	EngineTunnelPort   int
+	AdvertiseHost      string
+	RequireObm         bool
+	WaitForNode        bool
+	WaitForNodeTimeout int
+	Placement          string
+	PlacementGroup     string
+	RackTagPrefix      string
+	NodeSelection      string
+	MinCPUs            int
+	MinMemoryMB        int
+	ReservationTTL     int
+	PowerAPI           string
+	ObmService         string
+	ObmHost            string
+	ObmUser            string
+	ObmPassword        string
+	GracefulStop       string
+	StopGracePeriod    int
+	StartTimeout       int
+	HealthCheck        bool
+	PowerTimeout       int
+	PowerPollInterval  int
+	PowerOnGraph       string
+	PowerOffGraph      string
+	RebootGraph        string
+	Reserved           bool
+	Transport          string
+	WFPollInterval     int
+	WFTimeout          int
+	ConsoleCapture     bool
+	ConsoleCommand     string
+	EngineLabels       bool
+	RemoveWorkflow     string
+	RemoveWFOptions    string
+	RemoveWFTimeout    int
+	SSHAttempts        int
+	SSHTimeout         int
+	clientMonorail     *apiclientMonorail.Monorail
+	clientRedfish      *apiclientRedfish.Redfish
+	bastionLock        sync.Mutex
+	bastionClient      *cryptossh.Client
+	sshTunnel          net.Listener
+	engineTunnel       net.Listener
+	ipLock             sync.Mutex
 }
 
 const (
-	defaultEndpoint      = "localhost:8080"
-	defaultTransport     = "http"
-	defaultSSHPassword   = "root"
-	defaultWFPollIntSecs = 15
-	defaultWFTimeoutMins = 60
-	defaultSSHAttempts   = 10
-	defaultSSHTimeout    = 15
+	defaultEndpoint         = "localhost:8080"
+	defaultTransport        = "http"
+	defaultSSHPassword      = "root"
+	defaultWFPollIntSecs    = 15
+	defaultWFTimeoutMins    = 60
+	defaultSSHAttempts      = 10
+	defaultSSHTimeout       = 15
+	defaultSSHKeyType       = sshKeyTypeRSA
+	defaultEnginePort       = 2376
+	defaultWaitForNodeMins  = 30
+	defaultNodeSelection    = selectionFirstFit
+	defaultStartTimeoutMins = 10
 )
 
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
@@ -75,24 +127,161 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "RACKHD_SKU_ID",
 			Name:   "rackhd-sku-id",
-			Usage:  "SKU ID to use as pool of nodes to choose from",
+			Usage:  "SKU ID to use as pool of nodes to choose from. A comma-separated list is tried in order",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "RACKHD_SKU_NAME",
 			Name:   "rackhd-sku-name",
-			Usage:  "Friendly SKU NAME to use as pool of nodes to choose from",
+			Usage:  "Friendly SKU NAME to use as pool of nodes to choose from. A comma-separated list is tried in order",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "RACKHD_WAIT_FOR_NODE",
+			Name:   "rackhd-wait-for-node",
+			Usage:  "Wait for a node in the SKU to become free instead of failing at once",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_WAIT_FOR_NODE_TIMEOUT",
+			Name:   "rackhd-wait-for-node-timeout",
+			Usage:  "max time in minutes to wait for a free node in the SKU",
+			Value:  defaultWaitForNodeMins,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_PLACEMENT",
+			Name:   "rackhd-placement",
+			Usage:  "Placement policy for nodes chosen from a SKU. Specify spread or pack (requires --rackhd-placement-group)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_PLACEMENT_GROUP",
+			Name:   "rackhd-placement-group",
+			Usage:  "Label shared by machines that are placed together, such as the members of a swarm",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_RACK_TAG_PREFIX",
+			Name:   "rackhd-rack-tag-prefix",
+			Usage:  "Prefix of the node tags naming the rack a node is in",
+			Value:  defaultRackTagPrefix,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_NODE_SELECTION",
+			Name:   "rackhd-node-selection",
+			Usage:  "Strategy for choosing among free nodes of a SKU. Specify first-fit, random, lru or smallest-fit",
+			Value:  defaultNodeSelection,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_MIN_CPUS",
+			Name:   "rackhd-min-cpus",
+			Usage:  "Minimum number of CPUs of a node chosen from a SKU",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_MIN_MEMORY",
+			Name:   "rackhd-min-memory",
+			Usage:  "Minimum memory in MB of a node chosen from a SKU",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_RESERVATION_TTL",
+			Name:   "rackhd-reservation-ttl",
+			Usage:  "Time in minutes after which a node reserved by a machine that was never created may be reclaimed (0 never reclaims)",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "RACKHD_WORKFLOW_NAME",
 			Name:   "rackhd-workflow-name",
 			Usage:  "Name of workflow to invoke after node is chosen (optional)",
 		},
+		mcnflag.BoolFlag{
+			EnvVar: "RACKHD_REQUIRE_OBM",
+			Name:   "rackhd-require-obm",
+			Usage:  "Fail if the node has no OBM settings, which start, stop, restart and kill depend on",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "RACKHD_TRANSPORT",
 			Name:   "rackhd-transport",
 			Usage:  "RackHD Endpoint Transport. Specify http or https.",
 			Value:  defaultTransport,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_OBM_SERVICE",
+			Name:   "rackhd-obm-service",
+			Usage:  "OBM service to use when a node has several (by default IPMI is preferred, then Redfish, then others)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_OBM_HOST",
+			Name:   "rackhd-obm-host",
+			Usage:  "BMC address to configure as the OBM of the node (uses --rackhd-obm-service, ipmi-obm-service by default)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_OBM_USER",
+			Name:   "rackhd-obm-user",
+			Usage:  "BMC user to configure as the OBM of the node",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_OBM_PASSWORD",
+			Name:   "rackhd-obm-password",
+			Usage:  "BMC password to configure as the OBM of the node",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_POWER_API",
+			Name:   "rackhd-power-api",
+			Usage:  "API used for start, stop, restart and kill. Specify monorail (power graphs) or redfish (ComputerSystem.Reset)",
+			Value:  defaultPowerAPI,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_POWER_TIMEOUT",
+			Name:   "rackhd-power-timeout",
+			Usage:  "max time in minutes to wait for a power action to finish",
+			Value:  defaultPowerTimeoutMins,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_POWER_POLL",
+			Name:   "rackhd-power-poll",
+			Usage:  "frequency in seconds to poll for status of a power action",
+			Value:  defaultPowerPollSecs,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_POWER_ON_GRAPH",
+			Name:   "rackhd-power-on-graph",
+			Usage:  "Name of the workflow that powers on the node",
+			Value:  powerGraphs[powerOn],
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_POWER_OFF_GRAPH",
+			Name:   "rackhd-power-off-graph",
+			Usage:  "Name of the workflow that powers off the node",
+			Value:  powerGraphs[powerOff],
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_REBOOT_GRAPH",
+			Name:   "rackhd-reboot-graph",
+			Usage:  "Name of the workflow that reboots the node",
+			Value:  powerGraphs[powerReboot],
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_GRACEFUL_STOP",
+			Name:   "rackhd-graceful-stop",
+			Usage:  "How stop asks the OS to shut down before forcing power off. Specify ssh, acpi (Redfish GracefulShutdown) or none",
+			Value:  defaultGracefulStop,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_STOP_GRACE_PERIOD",
+			Name:   "rackhd-stop-grace-period",
+			Usage:  "Time in seconds stop waits for the node to power off before forcing it",
+			Value:  defaultStopGracePeriod,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_START_TIMEOUT",
+			Name:   "rackhd-start-timeout",
+			Usage:  "max time in minutes start and restart wait for the node to accept SSH again",
+			Value:  defaultStartTimeoutMins,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "RACKHD_ENGINE_LABELS",
+			Name:   "rackhd-engine-labels",
+			Usage:  "label the Docker engine with the SKU, rack, enclosure, CPU, memory, disk type, NIC speed and ID of the node. Cannot be combined with --engine-label",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "RACKHD_HEALTH_CHECK",
+			Name:   "rackhd-health-check",
+			Usage:  "report a powered on node as an error when it answers on neither its SSH nor its Docker port",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "RACKHD_SSH_USER",
 			Name:   "rackhd-ssh-user",
@@ -116,6 +305,48 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "rackhd-ssh-key",
 			Usage:  "SSH private key path (if not provided, default SSH key will be used)",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_SSH_BOOTSTRAP_KEY",
+			Name:   "rackhd-ssh-bootstrap-key",
+			Usage:  "SSH private key path used to install the generated key (tried before ssh-agent, password and keyboard-interactive)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_SSH_KEY_TYPE",
+			Name:   "rackhd-ssh-key-type",
+			Usage:  "Type of SSH key to generate when no SSH key is provided. Specify rsa, ecdsa or ed25519.",
+			Value:  defaultSSHKeyType,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_SSH_KEY_BITS",
+			Name:   "rackhd-ssh-key-bits",
+			Usage:  "Size in bits of the generated rsa (default 2048) or ecdsa (256, 384 or 521, default 256) SSH key",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_SSH_BASTION",
+			Name:   "rackhd-ssh-bastion",
+			Usage:  "SSH bastion ([user@]host[:port]) to reach nodes on networks docker-machine cannot access directly",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_SSH_BASTION_USER",
+			Name:   "rackhd-ssh-bastion-user",
+			Usage:  "SSH user for the bastion host (defaults to the local user)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_SSH_BASTION_KEY",
+			Name:   "rackhd-ssh-bastion-key",
+			Usage:  "SSH private key path for the bastion host (if not provided, ssh-agent will be used)",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_ENGINE_PORT",
+			Name:   "rackhd-engine-port",
+			Usage:  "Port the Docker engine listens on",
+			Value:  defaultEnginePort,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_ADVERTISE_HOSTNAME",
+			Name:   "rackhd-advertise-hostname",
+			Usage:  "Hostname to advertise instead of the node IP. May be a template using {{.MachineName}}, {{.NodeID}} and {{.IPAddress}}",
+		},
 		mcnflag.IntFlag{
 			EnvVar: "RACKHD_WORKFLOW_TIMEOUT",
 			Name:   "rackhd-workflow-timeout",
@@ -128,6 +359,33 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "frequency in seconds to poll for status of active workflow",
 			Value:  defaultWFPollIntSecs,
 		},
+		mcnflag.BoolFlag{
+			EnvVar: "RACKHD_CONSOLE_CAPTURE",
+			Name:   "rackhd-console-capture",
+			Usage:  "capture the serial console of the node to console.log in the machine directory while the workflow runs",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_CONSOLE_COMMAND",
+			Name:   "rackhd-console-command",
+			Usage:  "command that prints the serial console of the node. May use {{.Host}}, {{.User}} and {{.Password}} of the node's OBM and {{.NodeID}}. The password is also in $IPMI_PASSWORD",
+			Value:  defaultConsoleCommand,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_REMOVE_WORKFLOW",
+			Name:   "rackhd-remove-workflow",
+			Usage:  "Name of RackHD workflow, such as Graph.Drive.SecureErase, to run on the node before it is removed",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "RACKHD_REMOVE_WORKFLOW_OPTIONS",
+			Name:   "rackhd-remove-workflow-options",
+			Usage:  "JSON object with the options of the remove workflow",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "RACKHD_REMOVE_WORKFLOW_TIMEOUT",
+			Name:   "rackhd-remove-workflow-timeout",
+			Usage:  "max time in minutes to wait for the remove workflow to finish",
+			Value:  defaultRemoveWFTimeoutMins,
+		},
 		mcnflag.IntFlag{
 			EnvVar: "RACKHD_SSH_ATTEMPTS",
 			Name:   "rackhd-ssh-attempts",
@@ -153,13 +411,28 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 
 func NewDriver(hostName, storePath string) *Driver {
 	return &Driver{
-		Endpoint:       defaultEndpoint,
-		SSHPassword:    defaultSSHPassword,
-		Transport:      defaultTransport,
-		WFPollInterval: defaultWFPollIntSecs,
-		WFTimeout:      defaultWFTimeoutMins,
-		SSHAttempts:    defaultSSHAttempts,
-		SSHTimeout:     defaultSSHTimeout,
+		Endpoint:           defaultEndpoint,
+		SSHPassword:        defaultSSHPassword,
+		Transport:          defaultTransport,
+		WFPollInterval:     defaultWFPollIntSecs,
+		WFTimeout:          defaultWFTimeoutMins,
+		RemoveWFTimeout:    defaultRemoveWFTimeoutMins,
+		SSHAttempts:        defaultSSHAttempts,
+		SSHTimeout:         defaultSSHTimeout,
+		SSHKeyType:         defaultSSHKeyType,
+		EnginePort:         defaultEnginePort,
+		WaitForNodeTimeout: defaultWaitForNodeMins,
+		RackTagPrefix:      defaultRackTagPrefix,
+		NodeSelection:      defaultNodeSelection,
+		PowerAPI:           defaultPowerAPI,
+		GracefulStop:       defaultGracefulStop,
+		StopGracePeriod:    defaultStopGracePeriod,
+		StartTimeout:       defaultStartTimeoutMins,
+		PowerTimeout:       defaultPowerTimeoutMins,
+		PowerPollInterval:  defaultPowerPollSecs,
+		PowerOnGraph:       powerGraphs[powerOn],
+		PowerOffGraph:      powerGraphs[powerOff],
+		RebootGraph:        powerGraphs[powerReboot],
 		BaseDriver: &drivers.BaseDriver{
 			MachineName: hostName,
 			StorePath:   storePath,
@@ -175,14 +448,18 @@ func (d *Driver) DriverName() string {
 	return "rackhd"
 }
 
-/* Need this silly wrapper around d.GetSSHPort() because
-   BaseDriver.GetSSHPort() returns an (int, error), but err
-   is always hardcoded to nil. Want to use it to return the
-   port because it handles defaults already, but can't use it
-   "inline" because it's a multi-return Value
+/*
+Need this silly wrapper around d.BaseDriver.GetSSHPort() because
+
+	BaseDriver.GetSSHPort() returns an (int, error), but err
+	is always hardcoded to nil. Want to use it to return the
+	port because it handles defaults already, but can't use it
+	"inline" because it's a multi-return Value. It is also the
+	node's real SSH port, whereas d.GetSSHPort() returns the
+	local end of the bastion tunnel when one is configured.
 */
 func (d *Driver) getSSHPort() int {
-	port, _ := d.GetSSHPort()
+	port, _ := d.BaseDriver.GetSSHPort()
 	return port
 }
 
@@ -190,8 +467,8 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Endpoint = flags.String("rackhd-endpoint")
 
 	d.NodeID = flags.String("rackhd-node-id")
-	d.SkuID = flags.String("rackhd-sku-id")
-	d.SkuName = flags.String("rackhd-sku-name")
+	d.SkuID = strings.Join(splitList(flags.String("rackhd-sku-id")), ",")
+	d.SkuName = strings.Join(splitList(flags.String("rackhd-sku-name")), ",")
 	if d.NodeID == "" && d.SkuID == "" && d.SkuName == "" {
 		return fmt.Errorf("rackhd driver requires either the --rackhd-node-id or --rackhd-sku-[id/name] option")
 	}
@@ -203,6 +480,69 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	}
 
 	d.WorkflowName = flags.String("rackhd-workflow-name")
+	d.RequireObm = flags.Bool("rackhd-require-obm")
+	d.WaitForNode = flags.Bool("rackhd-wait-for-node")
+	d.WaitForNodeTimeout = flags.Int("rackhd-wait-for-node-timeout")
+	if d.WaitForNode && d.NodeID != "" {
+		return fmt.Errorf("--rackhd-wait-for-node can only be used with --rackhd-sku-[id/name]")
+	}
+
+	d.Placement = strings.ToLower(flags.String("rackhd-placement"))
+	d.PlacementGroup = flags.String("rackhd-placement-group")
+	d.RackTagPrefix = flags.String("rackhd-rack-tag-prefix")
+	if err := validatePlacement(d.Placement); err != nil {
+		return err
+	}
+	if d.Placement != "" && d.PlacementGroup == "" {
+		return fmt.Errorf("--rackhd-placement requires --rackhd-placement-group")
+	}
+	if d.Placement != "" && d.NodeID != "" {
+		return fmt.Errorf("--rackhd-placement can only be used with --rackhd-sku-[id/name]")
+	}
+
+	d.NodeSelection = strings.ToLower(flags.String("rackhd-node-selection"))
+	if err := validateSelection(d.NodeSelection); err != nil {
+		return err
+	}
+	d.MinCPUs = flags.Int("rackhd-min-cpus")
+	d.MinMemoryMB = flags.Int("rackhd-min-memory")
+	d.ReservationTTL = flags.Int("rackhd-reservation-ttl")
+
+	d.ObmService = flags.String("rackhd-obm-service")
+	d.ObmHost = flags.String("rackhd-obm-host")
+	d.ObmUser = flags.String("rackhd-obm-user")
+	d.ObmPassword = flags.String("rackhd-obm-password")
+	if err := validateObmSettings(d.ObmHost, d.ObmUser, d.ObmPassword, d.NodeID); err != nil {
+		return err
+	}
+	if d.ObmHost != "" && d.ObmService == "" {
+		d.ObmService = defaultObmService
+	}
+
+	d.PowerAPI = strings.ToLower(flags.String("rackhd-power-api"))
+	if err := validatePowerAPI(d.PowerAPI); err != nil {
+		return err
+	}
+	d.PowerTimeout = flags.Int("rackhd-power-timeout")
+	d.PowerPollInterval = flags.Int("rackhd-power-poll")
+	if d.PowerTimeout <= 0 || d.PowerPollInterval <= 0 {
+		return fmt.Errorf("--rackhd-power-timeout and --rackhd-power-poll must be greater than 0")
+	}
+	d.PowerOnGraph = flags.String("rackhd-power-on-graph")
+	d.PowerOffGraph = flags.String("rackhd-power-off-graph")
+	d.RebootGraph = flags.String("rackhd-reboot-graph")
+
+	d.GracefulStop = strings.ToLower(flags.String("rackhd-graceful-stop"))
+	if err := validateGracefulStop(d.GracefulStop); err != nil {
+		return err
+	}
+	d.StopGracePeriod = flags.Int("rackhd-stop-grace-period")
+	d.StartTimeout = flags.Int("rackhd-start-timeout")
+	d.HealthCheck = flags.Bool("rackhd-health-check")
+	d.EngineLabels = flags.Bool("rackhd-engine-labels")
+	if d.EngineLabels && len(flags.StringSlice("engine-label")) > 0 {
+		return fmt.Errorf("--rackhd-engine-labels cannot be combined with --engine-label, Docker does not start with labels in both daemon.json and its flags")
+	}
 
 	d.SSHUser = flags.String("rackhd-ssh-user")
 	d.SSHPassword = flags.String("rackhd-ssh-password")
@@ -216,8 +556,72 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		}
 	}
 
+	d.SSHBootstrapKey = flags.String("rackhd-ssh-bootstrap-key")
+	if d.SSHBootstrapKey != "" {
+		if _, err := os.Stat(d.SSHBootstrapKey); os.IsNotExist(err) {
+			return fmt.Errorf("SSH bootstrap key does not exist: %q", d.SSHBootstrapKey)
+		}
+	}
+
+	d.SSHBastion = flags.String("rackhd-ssh-bastion")
+	d.SSHBastionUser = flags.String("rackhd-ssh-bastion-user")
+	d.SSHBastionKey = flags.String("rackhd-ssh-bastion-key")
+	if d.SSHBastion != "" {
+		user, host := parseBastion(d.SSHBastion)
+		if host == "" {
+			return fmt.Errorf("Invalid SSH bastion %q, expected [user@]host[:port]", d.SSHBastion)
+		}
+		d.SSHBastion = host
+		if d.SSHBastionUser == "" {
+			d.SSHBastionUser = user
+		}
+		if d.SSHBastionUser == "" {
+			d.SSHBastionUser = os.Getenv("USER")
+		}
+		if d.SSHBastionKey != "" {
+			if _, err := os.Stat(d.SSHBastionKey); os.IsNotExist(err) {
+				return fmt.Errorf("SSH bastion key does not exist: %q", d.SSHBastionKey)
+			}
+		}
+	} else if d.SSHBastionUser != "" || d.SSHBastionKey != "" {
+		return fmt.Errorf("--rackhd-ssh-bastion-user and --rackhd-ssh-bastion-key require --rackhd-ssh-bastion")
+	}
+
+	d.SSHKeyType = strings.ToLower(flags.String("rackhd-ssh-key-type"))
+	d.SSHKeyBits = flags.Int("rackhd-ssh-key-bits")
+	if err := validateSSHKeyType(d.SSHKeyType, d.SSHKeyBits); err != nil {
+		return err
+	}
+
+	d.EnginePort = flags.Int("rackhd-engine-port")
+	if d.EnginePort <= 0 || d.EnginePort > 65535 {
+		return fmt.Errorf("Invalid Docker engine port: %d", d.EnginePort)
+	}
+	d.AdvertiseHost = flags.String("rackhd-advertise-hostname")
+	if d.AdvertiseHost != "" {
+		if _, err := template.New("hostname").Parse(d.AdvertiseHost); err != nil {
+			return fmt.Errorf("Invalid advertise hostname template %q. Error: %s", d.AdvertiseHost, err)
+		}
+	}
+
 	d.WFPollInterval = flags.Int("rackhd-workflow-poll")
 	d.WFTimeout = flags.Int("rackhd-workflow-timeout")
+
+	d.ConsoleCapture = flags.Bool("rackhd-console-capture")
+	d.ConsoleCommand = flags.String("rackhd-console-command")
+	if d.ConsoleCapture {
+		if _, err := renderConsoleCommand(d.ConsoleCommand, consoleParams{}); err != nil {
+			return err
+		}
+	}
+
+	d.RemoveWorkflow = flags.String("rackhd-remove-workflow")
+	d.RemoveWFOptions = flags.String("rackhd-remove-workflow-options")
+	d.RemoveWFTimeout = flags.Int("rackhd-remove-workflow-timeout")
+	if err := validateRemoveWorkflow(d.RemoveWorkflow, d.RemoveWFOptions); err != nil {
+		return err
+	}
+
 	d.SSHAttempts = flags.Int("rackhd-ssh-attempts")
 	d.SSHTimeout = flags.Int("rackhd-ssh-timeout")
 
@@ -243,6 +647,18 @@ func (d *Driver) PreCreateCheck() error {
 
 	log.Infof("Test Passed. %v Monorail and Redfish API's are accessible and installation will begin", d.Endpoint)
 
+	if d.NodeID != "" {
+		err = d.resolveNodeID(clientMonorail)
+		if err != nil {
+			return err
+		}
+
+		err = d.checkNode(clientMonorail)
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.SkuName != "" {
 		log.Debugf("Looking up SKU ID by name")
 		err = d.lookupSkuByName(clientMonorail)
@@ -260,8 +676,13 @@ func (d *Driver) PreCreateCheck() error {
 		log.Infof("Found a free node within SKU, Node ID: %v", d.NodeID)
 	}
 
+	err = d.reserveNode()
+	if err != nil {
+		return err
+	}
+
 	if d.SSHKeyPath == "" {
-		log.Infof("No SSH Key specified. Will attempt login with user/pass and upload generated key pair")
+		log.Infof("No SSH Key specified. Will attempt login with bootstrap key, ssh-agent or user/pass and upload generated key pair")
 	}
 
 	return nil
@@ -271,77 +692,228 @@ func (d *Driver) Create() error {
 	//Generate the client
 	client := d.getClientMonorail()
 
+	err := d.create(client)
+	if err != nil {
+		if d.Reserved {
+			// give the node back to the pool rather than leaving it
+			// reserved by a machine that does not exist
+			log.Infof("Releasing reservation of node %v", d.NodeID)
+			if node, nodeErr := d.getNode(client, d.NodeID); nodeErr != nil {
+				log.Warnf("Unable to release node %v. Error: %s", d.NodeID, nodeErr)
+			} else if relErr := d.releaseNode(client, node); relErr != nil {
+				log.Warnf("Unable to release node %v. Error: %s", d.NodeID, relErr)
+			} else {
+				d.Reserved = false
+			}
+		}
+		return err
+	}
+
+	if d.Reserved {
+		return d.tagNode(d.NodeID, provisionedTag)
+	}
+	return nil
+}
+
+func (d *Driver) create(client *apiclientMonorail.Monorail) error {
 	if d.WorkflowName != "" {
-		wfInstance, err := d.applyWorkflow(client, d.WorkflowName)
+		wfInstance, err := d.applyWorkflow(client, d.WorkflowName, nil)
 		if err != nil {
 			return err
 		}
 		log.Debugf("Workflow %s applied as instance id %s", d.WorkflowName, wfInstance)
-		err = d.waitForWorkflow(client, wfInstance, d.WFTimeout, d.WFPollInterval)
+		err = d.waitForInstall(client, wfInstance)
 		if err != nil {
 			return err
 		}
 	}
 
-	return d.checkConnectivity(client)
+	err := d.checkConnectivity(client)
+	if err != nil {
+		return err
+	}
+
+	inv := d.collectInventory(client)
+	if _, err := d.saveInventory(inv); err != nil {
+		log.Warnf("Unable to save the inventory of node %v. Error: %s", d.NodeID, err)
+	}
+
+	// the labels are a convenience, a machine without them is still usable
+	if d.EngineLabels {
+		if err := d.applyEngineLabels(client, inv); err != nil {
+			log.Warnf("Unable to label the Docker engine of node %v. Error: %s", d.NodeID, err)
+		}
+	}
+	return nil
 }
 
 func (d *Driver) chooseNode(client *apiclientMonorail.Monorail) error {
+	var timeout <-chan time.Time
+	if d.WaitForNode {
+		log.Debugf("Waiting up to %v minutes for a free node in SKU", d.WaitForNodeTimeout)
+		timeout = time.After(time.Duration(d.WaitForNodeTimeout) * time.Minute)
+	}
+
+	for {
+		// every listed SKU is read first, as machines of the placement
+		// group may already run on nodes of any of them
+		skuIDs := splitList(d.SkuID)
+		pools := make([][]rackhdNode, len(skuIDs))
+		allNodes := []rackhdNode{}
+		for i, skuID := range skuIDs {
+			pool, err := d.getSkuNodes(client, skuID)
+			if err != nil {
+				return err
+			}
+			pools[i] = pool
+			allNodes = append(allNodes, pool...)
+		}
+
+		// SKUs are tried in order, falling back to the next one when the
+		// preferred pool is exhausted
+		for i, skuID := range skuIDs {
+			chosenNode, err := d.findFreeNode(client, pools[i], allNodes)
+			if err != nil {
+				return err
+			}
+			if chosenNode == nil {
+				log.Debugf("No free node in SKU %v", skuID)
+				continue
+			}
+
+			if stringInSlice(reservationTag, chosenNode.Tags) {
+				err = d.reclaimNode(client, chosenNode)
+				if err != nil {
+					return err
+				}
+			}
+			d.NodeID = chosenNode.ID
+			d.NodeSkuID = skuID
+			return nil
+		}
+
+		if !d.WaitForNode {
+			return fmt.Errorf("No suitable node found in SKU")
+		}
+		log.Infof("No free node in SKU yet, checking again in %v seconds", d.WFPollInterval)
+		select {
+		case <-timeout:
+			return fmt.Errorf("Timeout waiting for a suitable node in SKU")
+		case <-time.After(time.Duration(d.WFPollInterval) * time.Second):
+		}
+	}
+}
+
+// getSkuNodes returns the nodes of the SKU skuID.
+func (d *Driver) getSkuNodes(client *apiclientMonorail.Monorail, skuID string) ([]rackhdNode, error) {
 	skuParams := skus.GetSkusIdentifierNodesParams{}
-	skuParams.WithIdentifier(d.SkuID)
+	skuParams.WithIdentifier(skuID)
 	resp, err := client.Skus.GetSkusIdentifierNodes(&skuParams, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var chosenNode modelsMonorail.Node
 	log.Debugf("%v", resp)
-	for _, node := range resp.Payload {
-		n := &modelsMonorail.Node{}
-		buf, err := json.Marshal(node)
-		if err != nil {
-			return err
+	pool := []rackhdNode{}
+	if err := decodePayload(resp.Payload, &pool); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// findFreeNode returns a node of pool that is neither reserved (or whose
+// reservation has expired) nor running a workflow and meets the hardware
+// requirements, chosen according to the placement policy and selection
+// strategy, or nil if there is none. allNodes holds the nodes of every
+// listed SKU, which placement counts the group's machines across.
+func (d *Driver) findFreeNode(client *apiclientMonorail.Monorail, pool, allNodes []rackhdNode) (*rackhdNode, error) {
+	candidates := []rackhdNode{}
+	for _, n := range pool {
+		if stringInSlice(reservationTag, n.Tags) && !reservationExpired(n, d.ReservationTTL, time.Now()) {
+			continue
 		}
-		err = json.Unmarshal(buf, n)
+
+		// nodes still being discovered or running someone else's graph are
+		// not free, even though they are not tagged yet
+		activeWorkflow, err := d.getActiveWorkflow(client, n.ID)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		tags := getTags(&n.Tags)
-		if !stringInSlice("dockermachine", tags) {
-			chosenNode = *n
-			break
+		if activeWorkflow != nil {
+			log.Debugf("Skipping node %v, busy running workflow %v", n.ID, activeWorkflow.Name)
+			continue
 		}
-	}
-	if chosenNode.ID == "" {
-		return fmt.Errorf("No suitable node found in SKU")
+
+		if d.RequireObm {
+			obms, err := d.getObms(client, n.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !hasPowerObm(obms, d.ObmService) {
+				log.Debugf("Skipping node %v, it has no OBM settings that can control its power", n.ID)
+				continue
+			}
+		}
+
+		candidates = append(candidates, n)
 	}
 
-	d.NodeID = chosenNode.ID
+	// hardware is only looked up when it matters, as it costs a catalog
+	// request per node
+	hardware := map[string]*nodeHardware{}
+	if d.MinCPUs > 0 || d.MinMemoryMB > 0 || d.NodeSelection == selectionSmallestFit {
+		fitting := []rackhdNode{}
+		for _, n := range candidates {
+			hw, err := d.getNodeHardware(client, n.ID)
+			if err != nil {
+				// one node with a broken catalog must not stop the
+				// rest of the SKU from being used
+				log.Warnf("Skipping node %v. Error: %s", n.ID, err)
+				continue
+			}
+			if !meetsRequirements(hw, d.MinCPUs, d.MinMemoryMB) {
+				log.Debugf("Skipping node %v, it has %v CPUs and %v MB of memory", n.ID, hw.CPUs, hw.MemoryMB)
+				continue
+			}
+			hardware[n.ID] = hw
+			fitting = append(fitting, n)
+		}
+		candidates = fitting
+	}
 
-	err = d.tagNode(d.NodeID, "dockermachine")
-	if err != nil {
-		return err
+	candidates = placeNodes(d.Placement, d.PlacementGroup, d.RackTagPrefix, candidates, allNodes)
+	if len(candidates) == 0 {
+		return nil, nil
 	}
-	return nil
+	chosen := selectNode(d.NodeSelection, candidates, hardware)
+	return &chosen, nil
 }
 
-func (d *Driver) applyWorkflow(client *apiclientMonorail.Monorail, wfName string) (string, error) {
+func (d *Driver) applyWorkflow(client *apiclientMonorail.Monorail, wfName string, options map[string]interface{}) (string, error) {
 	// POST workflow to node
 	params := nodes.NewPostNodesIdentifierWorkflowsParams()
 	params.WithIdentifier(d.NodeID)
 	params.WithName(wfName)
+	if options != nil {
+		body := make(map[string]interface{})
+		body["options"] = options
+		params.WithBody(body)
+	}
 	resp, err := client.Nodes.PostNodesIdentifierWorkflows(params, nil)
 	if err != nil {
 		return "", err
 	}
 
-	var id interface{}
-	id, err = getRootLevelVal(resp.Payload.(map[string]interface{}), "instanceId")
+	var wf nodeWorkflow
+	err = decodePayload(resp.Payload, &wf)
 	if err != nil {
 		return "", err
 	}
+	if wf.InstanceID == "" {
+		return "", fmt.Errorf("Key %v not found", "instanceId")
+	}
 
-	return id.(string), nil
+	return wf.InstanceID, nil
 }
 
 func (d *Driver) waitForWorkflow(client *apiclientMonorail.Monorail, wfInstance string, timeoutMins, pollSecs int) error {
@@ -366,67 +938,114 @@ func (d *Driver) waitForWorkflow(client *apiclientMonorail.Monorail, wfInstance
 				log.Debugf("Worklow successful!")
 				return nil
 			} else if resp.Payload.Status != "running" {
-				return fmt.Errorf("Workflow appears to have failed")
+				return fmt.Errorf("Workflow appears to have failed with status %q", resp.Payload.Status)
 			}
 		}
 	}
 }
 
-func getRootLevelVal(payload map[string]interface{}, keyToFind string) (interface{}, error) {
-	for key, val := range payload {
-		if key == keyToFind {
-			return val, nil
-		}
-	}
-	return nil, fmt.Errorf("Key %v not found", keyToFind)
-}
-
-func (d *Driver) checkConnectivity(client *apiclientMonorail.Monorail) error {
-
+// lookupIPs returns all IP addresses RackHD has handed out to the node
+func (d *Driver) lookupIPs(client *apiclientMonorail.Monorail) ([]string, error) {
 	// do a lookup on the ID to retrieve IP information
 	resp, err := client.Lookups.GetLookups(&lookups.GetLookupsParams{Q: &d.NodeID}, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	entries := []lookupEntry{}
+	if err := decodePayload(resp.Payload, &entries); err != nil {
+		return nil, err
 	}
 
 	// new slice for all IP addresses found for the node
 	ipAddSlice := make([]string, 0)
 
 	//loop through the response and grab all the IP addresses
-	for _, v := range resp.Payload {
-		if rec, ok := v.(map[string]interface{}); ok {
-			for key, val := range rec {
-				if key == "ipAddress" {
-					log.Debugf("Found IP Address for Node ID: %v", val.(string))
-					ipAddSlice = append(ipAddSlice, val.(string))
-				}
-			}
+	for _, entry := range entries {
+		if entry.IPAddress != "" {
+			log.Debugf("Found IP Address for Node ID: %v", entry.IPAddress)
+			ipAddSlice = append(ipAddSlice, entry.IPAddress)
 		}
 	}
 
 	//if the slice is empty that means there are no IPs
 	if len(ipAddSlice) <= 0 {
-		return fmt.Errorf("No IP addresses are associated with the Node ID specified. Error: %s", err)
+		return nil, fmt.Errorf("No IP addresses are associated with the Node ID specified")
 	}
+	return ipAddSlice, nil
+}
+
+// probeSSH reports whether the SSH port of the node accepts connections on
+// the given IP address
+func (d *Driver) probeSSH(ipAddy string) bool {
+	ipPort := ipAddy + ":" + strconv.Itoa(d.getSSHPort())
+	conn, err := d.dialNode(ipPort)
+	if err != nil {
+		log.Debugf("Connection failed on: %v", ipPort)
+		return false
+	}
+	log.Infof("Connection succeeded on: %v", ipPort)
+	conn.Close()
+	return true
+}
+
+// waitForSSH waits up to timeoutMins for SSH to come up on the node after a
+// power action, updating IPAddress if DHCP handed out a different address
+func (d *Driver) waitForSSH(client *apiclientMonorail.Monorail, timeoutMins int) error {
+	if timeoutMins <= 0 {
+		// machines created before the start timeout was configurable
+		timeoutMins = defaultStartTimeoutMins
+	}
+	deadline := time.Now().Add(time.Duration(timeoutMins) * time.Minute)
+	log.Infof("Waiting up to %v minutes for SSH on: %#v", timeoutMins, d.NodeID)
+	for {
+		// the lookups are refreshed every round as the node may get a new
+		// lease while it boots
+		ipAddSlice, err := d.lookupIPs(client)
+		if err != nil {
+			return err
+		}
+
+		// try the address the machine had before first
+		if stringInSlice(d.IPAddress, ipAddSlice) && d.probeSSH(d.IPAddress) {
+			return nil
+		}
+		for _, ipAddy := range ipAddSlice {
+			if ipAddy != d.IPAddress && d.probeSSH(ipAddy) {
+				log.Infof("IP address of %v changed from %v to %v", d.MachineName, d.IPAddress, ipAddy)
+				d.setIP(ipAddy)
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for SSH on node %v", d.NodeID)
+		}
+		time.Sleep(time.Duration(d.SSHTimeout) * time.Second)
+	}
+}
+
+func (d *Driver) checkConnectivity(client *apiclientMonorail.Monorail) error {
+	ipAddSlice, err := d.lookupIPs(client)
+	if err != nil {
+		return err
+	}
+
+	// a reprovisioned node may come back with a different address
+	d.setIP("")
 
 	// loop through slice and see if we can connect to the ip:ssh-port
 	for _, ipAddy := range ipAddSlice {
-		ipPort := ipAddy + ":" + strconv.Itoa(d.getSSHPort())
-		log.Debugf("Testing connection to: %v", ipPort)
+		log.Debugf("Testing connection to: %v:%v", ipAddy, d.getSSHPort())
 		// Some Workflows (like InstallCoreOS) indicate finished *before* the OS
 		// is up and accessible. Therefore, we need to try a few times to see if
 		// SSH is ready for us.
 		for attempt := 0; attempt < d.SSHAttempts; attempt++ {
-			conn, err := net.Dial("tcp", ipPort)
-			if err != nil {
-				log.Debugf("Connection failed on: %v", ipPort)
-				time.Sleep(time.Duration(d.SSHTimeout) * time.Second)
-			} else {
-				log.Infof("Connection succeeded on: %v", ipPort)
-				d.IPAddress = string(ipAddy)
-				conn.Close()
+			if d.probeSSH(ipAddy) {
+				d.setIP(ipAddy)
 				break
 			}
+			time.Sleep(time.Duration(d.SSHTimeout) * time.Second)
 		}
 		if d.IPAddress != "" {
 			break
@@ -434,7 +1053,7 @@ func (d *Driver) checkConnectivity(client *apiclientMonorail.Monorail) error {
 	}
 
 	if d.IPAddress == "" {
-		return fmt.Errorf("No IP addresses are accessible on this network to the Node ID specified. Error: %s", err)
+		return fmt.Errorf("No IP addresses are accessible on this network to the Node ID specified")
 	}
 
 	if d.SSHKeyPath == "" {
@@ -469,6 +1088,8 @@ func (d *Driver) checkConnectivity(client *apiclientMonorail.Monorail) error {
 	return nil
 }
 
+// lookupSkuByName sets d.SkuID to the IDs of the SKUs named in d.SkuName,
+// keeping their order.
 func (d *Driver) lookupSkuByName(client *apiclientMonorail.Monorail) error {
 	// Get list of all Skus
 	resp, err := client.Skus.GetSkus(nil, nil)
@@ -477,8 +1098,9 @@ func (d *Driver) lookupSkuByName(client *apiclientMonorail.Monorail) error {
 	}
 
 	log.Debugf("%v", resp)
-	n := &modelsMonorail.Sku{}
+	skuIDs := make(map[string]string)
 	for _, sku := range resp.Payload {
+		n := &modelsMonorail.Sku{}
 		buf, err := json.Marshal(sku)
 		if err != nil {
 			return err
@@ -487,21 +1109,37 @@ func (d *Driver) lookupSkuByName(client *apiclientMonorail.Monorail) error {
 		if err != nil {
 			return err
 		}
+		skuIDs[n.Name] = n.ID
+	}
 
-		if n.Name == d.SkuName {
-			d.SkuID = n.ID
-			return nil
+	ids := []string{}
+	for _, name := range splitList(d.SkuName) {
+		id, ok := skuIDs[name]
+		if !ok {
+			return fmt.Errorf("No matching SKU found: %v", name)
 		}
+		ids = append(ids, id)
 	}
-	return fmt.Errorf("No matching SKU found")
+	d.SkuID = strings.Join(ids, ",")
+	return nil
 }
 
 func (d *Driver) GetSSHHostname() (string, error) {
-	return d.GetIP()
+	if d.SSHBastion != "" {
+		return "127.0.0.1", nil
+	}
+	return d.getAdvertisedHost()
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.SSHBastion != "" {
+		return d.sshTunnelPort()
+	}
+	return d.BaseDriver.GetSSHPort()
 }
 
 func (d *Driver) createSSHKey() (string, error) {
-	if err := ssh.GenerateSSHKey(d.GetSSHKeyPath()); err != nil {
+	if err := generateSSHKey(d.GetSSHKeyPath(), d.publicSSHKeyPath(), d.SSHKeyType, d.SSHKeyBits); err != nil {
 		return "", err
 	}
 
@@ -514,56 +1152,116 @@ func (d *Driver) createSSHKey() (string, error) {
 }
 
 func (d *Driver) GetURL() (string, error) {
+	if d.SSHBastion != "" {
+		port, err := d.engineTunnelPort()
+		if err != nil {
+			return "", err
+		}
+		// localhost is among the names in the server certificate that
+		// libmachine generates, 127.0.0.1 is not
+		return fmt.Sprintf("tcp://%s", net.JoinHostPort("localhost", strconv.Itoa(port))), nil
+	}
+
+	host, err := d.getAdvertisedHost()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(host, strconv.Itoa(d.getEnginePort()))), nil
+}
+
+func (d *Driver) getEnginePort() int {
+	if d.EnginePort == 0 {
+		// machines created before the engine port was configurable
+		return defaultEnginePort
+	}
+	return d.EnginePort
+}
+
+// getAdvertisedHost returns the name clients should use to reach the node:
+// the rendered --rackhd-advertise-hostname if one is set, else the node IP.
+func (d *Driver) getAdvertisedHost() (string, error) {
 	ip, err := d.GetIP()
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	if d.AdvertiseHost == "" {
+		return ip, nil
+	}
+
+	tmpl, err := template.New("hostname").Parse(d.AdvertiseHost)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, struct {
+		MachineName string
+		NodeID      string
+		IPAddress   string
+	}{d.MachineName, d.NodeID, ip})
+	if err != nil {
+		return "", fmt.Errorf("Unable to render advertise hostname %q. Error: %s", d.AdvertiseHost, err)
+	}
+	return b.String(), nil
 }
 
 func (d *Driver) GetIP() (string, error) {
+	d.ipLock.Lock()
+	defer d.ipLock.Unlock()
+
 	if d.IPAddress == "" {
 		return "", fmt.Errorf("IP address is not set")
 	}
 	return d.IPAddress, nil
 }
 
+// setIP updates the node address. The bastion tunnels read it from their
+// own goroutines while waitForSSH may be changing it.
+func (d *Driver) setIP(ip string) {
+	d.ipLock.Lock()
+	defer d.ipLock.Unlock()
+
+	d.IPAddress = ip
+}
+
 func (d *Driver) GetState() (state.State, error) {
 
 	//Get the Out of Band Management Type
 	clientMonorail := d.getClientMonorail()
-	respObm, errObm := clientMonorail.Nodes.GetNodesIdentifierObm(&nodes.GetNodesIdentifierObmParams{Identifier: d.NodeID}, nil)
+	obm, errObm := d.getObm(clientMonorail)
+	if errObm == errNoObm {
+		return state.None, nil
+	}
 	if errObm != nil {
-		return state.None, errObm
+		return state.Error, errObm
 	}
 
-	if len(respObm.Payload) > 0 {
-		//If there is no obm (such as Vagrant), send back as Running
-		switch respObm.Payload[0].(map[string]interface{})["service"] {
-		case "noop-obm-service":
-			return state.Running, nil
-		default:
-			//Generate the client
-			clientRedfish := d.getClientRedfish()
-
-			// do a lookup on the Node ID to retrieve Power information
-			resp, err := clientRedfish.RedfishV1.GetSystem(&redfish_v1.GetSystemParams{Identifier: d.NodeID})
-			if err != nil {
-				return state.None, nil
-			}
-			switch resp.Payload.PowerState {
-			case "Online", "online", "Up", "up", "On", "on":
-				return state.Running, nil
-			case "Offline", "offline", "Down", "down", "Off", "off":
-				return state.Stopped, nil
-			case "Unknown", "unknown":
-				return state.None, nil
-			default:
-				return state.Running, nil
-			}
+	//If there is no obm (such as Vagrant), send back as Running
+	if !obm.controlsPower() {
+		if d.HealthCheck {
+			return d.checkHealth()
 		}
+		return state.Running, nil
 	}
-	return state.None, nil
+
+	//A power or provisioning workflow means the machine is on its way up or down
+	activeWorkflow, err := d.getActiveWorkflow(clientMonorail, d.NodeID)
+	if err != nil {
+		return state.Error, err
+	}
+	if activeWorkflow != nil {
+		return workflowState(activeWorkflow, d.powerGraph(powerOff)), nil
+	}
+
+	// do a lookup on the Node ID to retrieve Power information
+	system, err := d.getComputerSystem()
+	if err != nil {
+		return state.Error, fmt.Errorf("Unable to retrieve power state of node %v from Redfish. Error: %s", d.NodeID, err)
+	}
+	st, err := systemState(system)
+	if err != nil || st != state.Running || !d.HealthCheck {
+		return st, err
+	}
+	return d.checkHealth()
 }
 
 func (d *Driver) Start() error {
@@ -571,9 +1269,9 @@ func (d *Driver) Start() error {
 	client := d.getClientMonorail()
 
 	log.Debugf("Attempting Power On of: %#v", d.NodeID)
-	err := d.obmAction(client, "Graph.PowerOn.Node")
+	err := d.obmAction(client, powerOn)
 	if err != nil {
-		if err.Error() == "noop-obm-service" {
+		if err == errNoopObm {
 			return fmt.Errorf("OBM %s Type Not Supported For Starting", "noop-obm-service")
 		} else {
 			return err
@@ -581,35 +1279,48 @@ func (d *Driver) Start() error {
 	}
 
 	log.Infof("Node has succussfully been Powered On: %#v", d.NodeID)
-	return nil
+	return d.waitForSSH(client, d.StartTimeout)
 }
 
 func (d *Driver) Stop() error {
 	//Generate the client
 	client := d.getClientMonorail()
 
-	log.Debugf("Attempting Shutdown of: %#v", d.NodeID)
-	err := d.obmAction(client, "Graph.PowerOff.Node")
+	err := d.checkObm(client)
 	if err != nil {
-		if err.Error() == "noop-obm-service" {
+		if err == errNoopObm {
 			return fmt.Errorf("OBM %s Type Not Supported For Stopping", "noop-obm-service")
 		} else {
 			return err
 		}
 	}
 
-	log.Infof("Node has succussfully been Powered Off: %#v", d.NodeID)
-	return nil
+	log.Debugf("Attempting Graceful Shutdown of: %#v", d.NodeID)
+	err = d.gracefulStop()
+	if err == nil {
+		log.Infof("Node has succussfully been Shut Down: %#v", d.NodeID)
+		return nil
+	}
+	log.Infof("Graceful Shutdown did not complete (%s), forcing Power Off of: %#v", err, d.NodeID)
+
+	return d.Kill()
 }
 
 func (d *Driver) Remove() error {
 	//Generate the client
 	client := d.getClientMonorail()
 
+	if d.RemoveWorkflow != "" {
+		err := d.runRemoveWorkflow(client)
+		if err != nil {
+			return err
+		}
+	}
+
 	log.Debugf("Attempting Shutdown of: %#v", d.NodeID)
-	err := d.obmAction(client, "Graph.PowerOff.Node")
+	err := d.obmAction(client, powerOff)
 	if err != nil {
-		if err.Error() == "noop-obm-service" {
+		if err == errNoopObm {
 			log.Infof("OBM %s Type Not Supported For Stopping", "noop-obm-service")
 		} else {
 			log.Warnf("There was an issue Shutting Down the Server. Error: %s", err)
@@ -633,59 +1344,72 @@ func (d *Driver) Restart() error {
 	//Generate the client
 	client := d.getClientMonorail()
 
-	log.Debugf("Attempting Restart of: %#v", d.NodeID)
-	err := d.obmAction(client, "Graph.Reboot.Node")
+	err := d.checkObm(client)
 	if err != nil {
-		if err.Error() == "noop-obm-service" {
+		if err == errNoopObm {
 			return fmt.Errorf("OBM %s Type Not Supported For Restarting", "noop-obm-service")
 		} else {
 			return err
 		}
 	}
 
+	log.Debugf("Attempting Restart of: %#v", d.NodeID)
+	err = d.restart(client)
+	if err != nil {
+		return err
+	}
+
 	log.Infof("Node has succussfully been Restarted: %#v", d.NodeID)
-	return nil
+	return d.waitForSSH(client, d.StartTimeout)
 }
 
 func (d *Driver) Kill() error {
-	return d.Stop()
+	//Generate the client
+	client := d.getClientMonorail()
+
+	log.Debugf("Attempting Power Off of: %#v", d.NodeID)
+	err := d.obmAction(client, powerOff)
+	if err != nil {
+		if err == errNoopObm {
+			return fmt.Errorf("OBM %s Type Not Supported For Killing", "noop-obm-service")
+		} else {
+			return err
+		}
+	}
+
+	log.Infof("Node has succussfully been Powered Off: %#v", d.NodeID)
+	return nil
 }
 
 func (d *Driver) obmAction(clientMonorail *apiclientMonorail.Monorail, action string) error {
+	err := d.checkObm(clientMonorail)
+	if err != nil {
+		return err
+	}
+	return d.runPowerAction(clientMonorail, action)
+}
+
+// checkObm returns an error unless the node has an OBM that can control its
+// power
+func (d *Driver) checkObm(clientMonorail *apiclientMonorail.Monorail) error {
 	//Get the Out of Band Management Type
-	respObm, errObm := clientMonorail.Nodes.GetNodesIdentifierObm(&nodes.GetNodesIdentifierObmParams{Identifier: d.NodeID}, nil)
-	if errObm != nil {
-		return errObm
+	obm, err := d.getObm(clientMonorail)
+	if err != nil {
+		return err
 	}
 
-	if len(respObm.Payload) > 0 {
-		//If there is no obm (such as Vagrant), nil
-		switch respObm.Payload[0].(map[string]interface{})["service"] {
-		case "noop-obm-service":
-			return fmt.Errorf("noop-obm-service")
-		default:
-			wfInstance, err := d.applyWorkflow(clientMonorail, action)
-			if err != nil {
-				return err
-			}
-			log.Debugf("Workflow %s applied as instance id %s", action, wfInstance)
-			err = d.waitForWorkflow(clientMonorail, wfInstance, 1, 10)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
+	//If there is no obm (such as Vagrant), power cannot be controlled
+	if !obm.controlsPower() {
+		return errNoopObm
 	}
-	return fmt.Errorf("No OBM Detected")
+	return nil
 }
 
-func (d *Driver) tagNode(targetNode, targetTag string) error {
+func (d *Driver) tagNode(targetNode string, targetTags ...string) error {
 	clientMonorail := d.getClientMonorail()
 	params := nodes.NewPatchNodesIdentifierTagsParams()
 	body := make(map[string]interface{})
-	var tags [1]string
-	tags[0] = targetTag
-	body["tags"] = tags
+	body["tags"] = targetTags
 
 	params.WithBody(body)
 	params.WithIdentifier(targetNode)
@@ -720,22 +1444,36 @@ func (d *Driver) publicSSHKeyPath() string {
 	return d.GetSSHKeyPath() + ".pub"
 }
 
-// execute command over SSH with user / password authentication
+// execute command over SSH with the bootstrap authentication methods
 func executeSSHCommand(command string, d *Driver) error {
 	log.Debugf("Execute executeSSHCommand: %s", command)
 
+	auth, closeAgent, err := d.bootstrapAuthMethods()
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
 	config := &cryptossh.ClientConfig{
 		User: d.GetSSHUsername(),
-		Auth: []cryptossh.AuthMethod{
-			cryptossh.Password(d.SSHPassword),
-		},
+		Auth: auth,
+	}
+
+	addr := fmt.Sprintf("%s:%d", d.IPAddress, d.getSSHPort())
+	conn, err := d.dialNode(addr)
+	if err != nil {
+		log.Debugf("Failed to dial: %s", err)
+		return err
 	}
 
-	client, err := cryptossh.Dial("tcp", fmt.Sprintf("%s:%d", d.IPAddress, d.getSSHPort()), config)
+	c, chans, reqs, err := cryptossh.NewClientConn(conn, addr, config)
 	if err != nil {
-		log.Debugf("Failed to dial:", err)
+		conn.Close()
+		log.Debugf("Failed to dial: %s", err)
 		return err
 	}
+	client := cryptossh.NewClient(c, chans, reqs)
+	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
@@ -756,12 +1494,64 @@ func executeSSHCommand(command string, d *Driver) error {
 	return nil
 }
 
-func getTags(input *[]interface{}) []string {
-	tags := make([]string, len(*input))
-	for i, tag := range *input {
-		tags[i] = tag.(string)
+// bootstrapAuthMethods returns the SSH authentication methods used to log in
+// before the machine key is installed. The client tries them in order: the
+// bootstrap private key, the password, keyboard-interactive answering every
+// prompt with the password and finally keys held by ssh-agent
+// (SSH_AUTH_SOCK). The agent comes last because sshd drops the connection
+// after MaxAuthTries (6 by default) failed attempts, and an agent holding
+// several keys would use them all up before the password is tried.
+// The returned func closes the ssh-agent connection, if one was opened.
+func (d *Driver) bootstrapAuthMethods() ([]cryptossh.AuthMethod, func(), error) {
+	auth := []cryptossh.AuthMethod{}
+	closeAgent := func() {}
+
+	if d.SSHBootstrapKey != "" {
+		buf, err := ioutil.ReadFile(d.SSHBootstrapKey)
+		if err != nil {
+			return nil, closeAgent, err
+		}
+		signer, err := cryptossh.ParsePrivateKey(buf)
+		if err != nil {
+			return nil, closeAgent, fmt.Errorf("Unable to parse SSH bootstrap key %q. Error: %s", d.SSHBootstrapKey, err)
+		}
+		auth = append(auth, cryptossh.PublicKeys(signer))
+	}
+
+	auth = append(auth,
+		cryptossh.Password(d.SSHPassword),
+		cryptossh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range questions {
+				answers[i] = d.SSHPassword
+			}
+			return answers, nil
+		}),
+	)
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			log.Debugf("Unable to connect to ssh-agent at %s: %s", sock, err)
+		} else {
+			log.Debugf("Using keys from ssh-agent at %s", sock)
+			auth = append(auth, cryptossh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	return auth, closeAgent, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return tags
+	return items
 }
 
 func stringInSlice(a string, list []string) bool {
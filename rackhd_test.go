@@ -1,6 +1,7 @@
 package rackhd
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/docker/machine/libmachine/drivers"
@@ -127,3 +128,277 @@ func TestOnlySkuNameOrSkuIDAllowed(t *testing.T) {
 
 	assert.Error(t, err, "Should error if both SKU Name and ID are given")
 }
+
+func TestSSHBootstrapKeyMustExist(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":           "aabbccdd",
+			"rackhd-ssh-bootstrap-key": "/path/does/not/exist",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.Error(t, err, "Should error if the SSH bootstrap key does not exist")
+}
+
+func TestSetSSHBastion(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":     "aabbccdd",
+			"rackhd-ssh-bastion": "jump@bastion.example.com:2222",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "bastion.example.com:2222", d.SSHBastion)
+	assert.Equal(t, "jump", d.SSHBastionUser)
+	assert.Equal(t, "bastion.example.com:2222", d.bastionAddr())
+}
+
+func TestSSHBastionOptionsRequireBastion(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":          "aabbccdd",
+			"rackhd-ssh-bastion-user": "jump",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.Error(t, err, "Should error if bastion options are given without a bastion")
+}
+
+func TestGetURLDefaults(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+	d.IPAddress = "172.31.128.5"
+
+	url, err := d.GetURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://172.31.128.5:2376", url)
+
+	hostname, err := d.GetSSHHostname()
+	assert.NoError(t, err)
+	assert.Equal(t, "172.31.128.5", hostname)
+}
+
+func TestGetURLAdvertiseHostname(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":            "aabbccdd",
+			"rackhd-engine-port":        2377,
+			"rackhd-advertise-hostname": "{{.MachineName}}-{{.NodeID}}.example.com",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+	assert.NoError(t, err)
+
+	d.IPAddress = "172.31.128.5"
+
+	url, err := d.GetURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://default-aabbccdd.example.com:2377", url)
+
+	hostname, err := d.GetSSHHostname()
+	assert.NoError(t, err)
+	assert.Equal(t, "default-aabbccdd.example.com", hostname)
+}
+
+func TestGetURLThroughBastion(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+	d.SSHBastion = "bastion.example.com"
+	d.IPAddress = "172.31.128.5"
+
+	url, err := d.GetURL()
+	assert.NoError(t, err)
+	assert.NotEqual(t, 0, d.EngineTunnelPort)
+	assert.Equal(t, fmt.Sprintf("tcp://localhost:%d", d.EngineTunnelPort), url)
+	defer d.engineTunnel.Close()
+
+	// a later command keeps the saved port while it is taken
+	later := NewDriver("default", "path")
+	later.SSHBastion = d.SSHBastion
+	later.IPAddress = d.IPAddress
+	later.EngineTunnelPort = d.EngineTunnelPort
+
+	again, err := later.GetURL()
+	assert.NoError(t, err)
+	assert.Equal(t, url, again)
+}
+
+func TestWaitForNodeRequiresSku(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":       "aabbccdd",
+			"rackhd-wait-for-node": true,
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.Error(t, err, "Should error if waiting for a node without a SKU")
+}
+
+func TestSetSkuNameList(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-sku-name": "LargeNode, MediumNode,,SmallNode",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "LargeNode,MediumNode,SmallNode", d.SkuName)
+	assert.Equal(t, []string{"LargeNode", "MediumNode", "SmallNode"}, splitList(d.SkuName))
+}
+
+func TestSetPowerAPI(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":   "aabbccdd",
+			"rackhd-power-api": "Redfish",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "redfish", d.PowerAPI)
+
+	checkFlags.FlagsValues["rackhd-power-api"] = "ipmitool"
+	err = d.SetConfigFromFlags(checkFlags)
+
+	assert.Error(t, err, "Should error on an unsupported power API")
+}
+
+func TestSetObmCredentials(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":      "aabbccdd",
+			"rackhd-obm-host":     "10.1.1.5",
+			"rackhd-obm-user":     "admin",
+			"rackhd-obm-password": "secret",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.1.5", d.ObmHost)
+	assert.Equal(t, "admin", d.ObmUser)
+	assert.Equal(t, "secret", d.ObmPassword)
+	assert.Equal(t, "ipmi-obm-service", d.ObmService, "IPMI should be the default service for the BMC")
+
+	checkFlags.FlagsValues["rackhd-obm-service"] = "redfish-obm-service"
+	err = d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "redfish-obm-service", d.ObmService)
+}
+
+func TestSetGracefulStop(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id": "aabbccdd",
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ssh", d.GracefulStop)
+	assert.Equal(t, 120, d.StopGracePeriod)
+
+	checkFlags.FlagsValues["rackhd-graceful-stop"] = "reboot"
+	err = d.SetConfigFromFlags(checkFlags)
+
+	assert.Error(t, err, "Should error on an unsupported graceful stop method")
+}
+
+func TestSetPowerGraphs(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":         "aabbccdd",
+			"rackhd-power-off-graph": "Graph.Vendor.PowerOff",
+			"rackhd-power-timeout":   5,
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Graph.PowerOn.Node", d.powerGraph(powerOn))
+	assert.Equal(t, "Graph.Vendor.PowerOff", d.powerGraph(powerOff))
+	assert.Equal(t, "Graph.Reboot.Node", d.powerGraph(powerReboot))
+
+	timeoutMins, pollSecs := d.powerTimeouts()
+	assert.Equal(t, 5, timeoutMins)
+	assert.Equal(t, 10, pollSecs)
+}
+
+func TestEngineLabelsConflictWithEngineLabel(t *testing.T) {
+	// create the Driver
+	d := NewDriver("default", "path")
+
+	checkFlags := &drivers.CheckDriverOptions{
+		FlagsValues: map[string]interface{}{
+			"rackhd-node-id":       "aabbccdd",
+			"rackhd-engine-labels": true,
+			"engine-label":         []string{},
+		},
+		CreateFlags: d.GetCreateFlags(),
+	}
+
+	err := d.SetConfigFromFlags(checkFlags)
+	assert.NoError(t, err)
+
+	checkFlags.FlagsValues["engine-label"] = []string{"storage=ssd"}
+	err = d.SetConfigFromFlags(checkFlags)
+	assert.Error(t, err, "Should error when --engine-label is given as well")
+}
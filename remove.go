@@ -0,0 +1,70 @@
+package rackhd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// defaultRemoveWFTimeoutMins is generous because erasing every drive
+// of a node can take hours.
+const defaultRemoveWFTimeoutMins = 240
+
+// parseWorkflowOptions parses the JSON options of --rackhd-remove-workflow,
+// which RackHD merges into the options of the graph's tasks.
+func parseWorkflowOptions(options string) (map[string]interface{}, error) {
+	if options == "" {
+		return nil, nil
+	}
+	parsed := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(options), &parsed); err != nil {
+		return nil, fmt.Errorf("Invalid remove workflow options, a JSON object is expected. Error: %s", err)
+	}
+	return parsed, nil
+}
+
+func validateRemoveWorkflow(name, options string) error {
+	if name == "" {
+		if options != "" {
+			return fmt.Errorf("--rackhd-remove-workflow-options requires --rackhd-remove-workflow")
+		}
+		return nil
+	}
+	_, err := parseWorkflowOptions(options)
+	return err
+}
+
+// runRemoveWorkflow runs the --rackhd-remove-workflow graph, such as a secure
+// erase of the drives, and waits for it before the node is powered off and
+// removed. The node is only released if the workflow succeeds.
+func (d *Driver) runRemoveWorkflow(client *apiclientMonorail.Monorail) error {
+	options, err := parseWorkflowOptions(d.RemoveWFOptions)
+	if err != nil {
+		return err
+	}
+
+	timeoutMins := d.RemoveWFTimeout
+	if timeoutMins <= 0 {
+		timeoutMins = defaultRemoveWFTimeoutMins
+	}
+	pollSecs := d.WFPollInterval
+	if pollSecs <= 0 {
+		pollSecs = defaultWFPollIntSecs
+	}
+
+	log.Infof("Running remove workflow %s on node %v", d.RemoveWorkflow, d.NodeID)
+	wfInstance, err := d.applyWorkflow(client, d.RemoveWorkflow, options)
+	if err != nil {
+		return fmt.Errorf("Unable to start remove workflow %s on node %v. Error: %s", d.RemoveWorkflow, d.NodeID, err)
+	}
+	log.Debugf("Workflow %s applied as instance id %s", d.RemoveWorkflow, wfInstance)
+
+	err = d.waitForWorkflow(client, wfInstance, timeoutMins, pollSecs)
+	if err != nil {
+		return fmt.Errorf("Remove workflow %s (instance %s) did not succeed on node %v, the node has not been removed. Error: %s", d.RemoveWorkflow, wfInstance, d.NodeID, err)
+	}
+	log.Infof("Remove workflow %s (instance %s) succeeded on node %v", d.RemoveWorkflow, wfInstance, d.NodeID)
+	return nil
+}
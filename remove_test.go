@@ -0,0 +1,28 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkflowOptions(t *testing.T) {
+	options, err := parseWorkflowOptions("")
+	assert.NoError(t, err)
+	assert.Nil(t, options)
+
+	options, err = parseWorkflowOptions(`{"drive-secure-erase": {"eraseSettings": [{"disks": ["sdb"], "tool": "scrub"}]}}`)
+	assert.NoError(t, err)
+	assert.Contains(t, options, "drive-secure-erase")
+
+	_, err = parseWorkflowOptions(`["sdb"]`)
+	assert.Error(t, err, "Options must be a JSON object")
+}
+
+func TestValidateRemoveWorkflow(t *testing.T) {
+	assert.NoError(t, validateRemoveWorkflow("", ""))
+	assert.NoError(t, validateRemoveWorkflow("Graph.Drive.SecureErase", ""))
+	assert.NoError(t, validateRemoveWorkflow("Graph.Drive.SecureErase", `{"drive-secure-erase": {}}`))
+	assert.Error(t, validateRemoveWorkflow("", `{"drive-secure-erase": {}}`), "Options without a workflow should be rejected")
+	assert.Error(t, validateRemoveWorkflow("Graph.Drive.SecureErase", `{bad json`))
+}
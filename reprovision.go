@@ -0,0 +1,49 @@
+package rackhd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Reprovision reinstalls the OS of the machine on the node it already runs
+// on by running the install workflow again. A key pair the driver generated
+// is replaced by a new one, and the IP address, inventory and engine labels
+// are renewed. The node and machine name are kept, so unlike rm and create
+// it cannot end up on a different node of the SKU. Docker has to be
+// reinstalled afterwards with docker-machine provision.
+func (d *Driver) Reprovision() error {
+	if d.WorkflowName == "" {
+		return fmt.Errorf("Machine %s has no install workflow to rerun, it was created without --rackhd-workflow-name", d.MachineName)
+	}
+
+	client := d.getClientMonorail()
+
+	activeWorkflow, err := d.getActiveWorkflow(client, d.NodeID)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve workflows of node %v. Error: %s", d.NodeID, err)
+	}
+	if activeWorkflow != nil {
+		return fmt.Errorf("Node %v is busy running workflow %v (instance %v). Wait for it to finish or cancel it in RackHD", d.NodeID, activeWorkflow.Name, activeWorkflow.InstanceID)
+	}
+
+	// the old key pair is only replaced if the driver made it, a key given
+	// with --rackhd-ssh-key has to be installed by the workflow
+	if d.SSHKeyPath == "" || d.SSHKeyPath == d.ResolveStorePath("id_rsa") {
+		for _, path := range []string{d.GetSSHKeyPath(), d.publicSSHKeyPath()} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Unable to remove old SSH key %s. Error: %s", path, err)
+			}
+		}
+		d.SSHKeyPath = ""
+	}
+
+	log.Infof("Reprovisioning node %v of machine %s with workflow %s", d.NodeID, d.MachineName, d.WorkflowName)
+	err = d.create(client)
+	if err != nil {
+		return err
+	}
+	log.Infof("Node %v reprovisioned, reachable at %v", d.NodeID, d.IPAddress)
+	return nil
+}
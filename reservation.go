@@ -0,0 +1,126 @@
+package rackhd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	apiclientMonorail "github.com/codedellemc/gorackhd/client"
+	"github.com/codedellemc/gorackhd/client/nodes"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// A reserved node carries reservationTag plus tags recording which machine
+// reserved it, from which host and when. provisionedTag is added once the
+// machine has been created, after which the reservation never expires.
+const (
+	ownerTagPrefix    = "dockermachine-owner:"
+	hostTagPrefix     = "dockermachine-host:"
+	reservedTagPrefix = "dockermachine-reserved:"
+	provisionedTag    = "dockermachine-provisioned"
+)
+
+// reservationTags returns the tags that reserve a node for the machine.
+func reservationTags(machineName, hostname, group string, now time.Time) []string {
+	tags := []string{
+		reservationTag,
+		ownerTagPrefix + machineName,
+		hostTagPrefix + hostname,
+		reservedTagPrefix + strconv.FormatInt(now.Unix(), 10),
+	}
+	if group != "" {
+		tags = append(tags, groupTag(group))
+	}
+	return tags
+}
+
+// isReservationTag reports whether tag is one of the tags set by
+// reservationTags or when the machine is provisioned.
+func isReservationTag(tag string) bool {
+	if tag == reservationTag || tag == provisionedTag {
+		return true
+	}
+	for _, prefix := range []string{ownerTagPrefix, hostTagPrefix, reservedTagPrefix, groupTagPrefix} {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservationExpired reports whether the node's reservation is older than
+// ttlMins and was never followed by a successful create, so the node may be
+// reclaimed. Reservations without a timestamp, made by older versions of
+// the driver, never expire, nor does anything when ttlMins is 0.
+func reservationExpired(node rackhdNode, ttlMins int, now time.Time) bool {
+	if ttlMins <= 0 || !stringInSlice(reservationTag, node.Tags) || stringInSlice(provisionedTag, node.Tags) {
+		return false
+	}
+	for _, tag := range node.Tags {
+		if !strings.HasPrefix(tag, reservedTagPrefix) {
+			continue
+		}
+		secs, err := strconv.ParseInt(strings.TrimPrefix(tag, reservedTagPrefix), 10, 64)
+		if err != nil {
+			return false
+		}
+		return now.Sub(time.Unix(secs, 0)) > time.Duration(ttlMins)*time.Minute
+	}
+	return false
+}
+
+// reservationOwner returns the machine and host that reserved the node.
+func reservationOwner(node rackhdNode) (string, string) {
+	var machine, host string
+	for _, tag := range node.Tags {
+		if strings.HasPrefix(tag, ownerTagPrefix) {
+			machine = strings.TrimPrefix(tag, ownerTagPrefix)
+		} else if strings.HasPrefix(tag, hostTagPrefix) {
+			host = strings.TrimPrefix(tag, hostTagPrefix)
+		}
+	}
+	return machine, host
+}
+
+// reserveNode tags d.NodeID as reserved by this machine.
+func (d *Driver) reserveNode() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	log.Debugf("Reserving node %v for machine %v", d.NodeID, d.MachineName)
+	if err := d.tagNode(d.NodeID, reservationTags(d.MachineName, hostname, d.PlacementGroup, time.Now())...); err != nil {
+		return fmt.Errorf("Unable to reserve node %v. Error: %s", d.NodeID, err)
+	}
+	d.Reserved = true
+	return nil
+}
+
+// releaseNode removes every reservation tag from the node and records the
+// time of release, which the lru selection strategy takes into account.
+func (d *Driver) releaseNode(client *apiclientMonorail.Monorail, node *rackhdNode) error {
+	log.Debugf("Releasing node %v", node.ID)
+	for _, tag := range node.Tags {
+		if !isReservationTag(tag) && !strings.HasPrefix(tag, releasedTagPrefix) {
+			continue
+		}
+		params := nodes.NewDeleteNodesIdentifierTagsTagnameParams()
+		params.WithIdentifier(node.ID)
+		params.WithTagName(tag)
+		if _, err := client.Nodes.DeleteNodesIdentifierTagsTagname(params, nil); err != nil {
+			return fmt.Errorf("Unable to remove tag %q from node %v. Error: %s", tag, node.ID, err)
+		}
+	}
+
+	return d.tagNode(node.ID, releasedTagPrefix+strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+// reclaimNode releases a node whose reservation has expired.
+func (d *Driver) reclaimNode(client *apiclientMonorail.Monorail, node *rackhdNode) error {
+	machine, host := reservationOwner(*node)
+	log.Infof("Reclaiming node %v, reserved by machine %q on %q more than %v minutes ago without being provisioned", node.ID, machine, host, d.ReservationTTL)
+	return d.releaseNode(client, node)
+}
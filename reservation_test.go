@@ -0,0 +1,46 @@
+package rackhd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservationTags(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tags := reservationTags("rackhdtest", "workstation", "swarm", now)
+
+	assert.Equal(t, []string{
+		"dockermachine",
+		"dockermachine-owner:rackhdtest",
+		"dockermachine-host:workstation",
+		"dockermachine-reserved:1500000000",
+		"dockermachine-group:swarm",
+	}, tags)
+
+	for _, tag := range tags {
+		assert.True(t, isReservationTag(tag), tag)
+	}
+	assert.False(t, isReservationTag("rack:r1"))
+	assert.False(t, isReservationTag(releasedTagPrefix+"1500000000"))
+
+	machine, host := reservationOwner(rackhdNode{Tags: tags})
+	assert.Equal(t, "rackhdtest", machine)
+	assert.Equal(t, "workstation", host)
+}
+
+func TestReservationExpired(t *testing.T) {
+	reserved := time.Unix(1500000000, 0)
+	node := rackhdNode{Tags: reservationTags("rackhdtest", "workstation", "", reserved)}
+
+	assert.False(t, reservationExpired(node, 60, reserved.Add(30*time.Minute)))
+	assert.True(t, reservationExpired(node, 60, reserved.Add(90*time.Minute)))
+	assert.False(t, reservationExpired(node, 0, reserved.Add(90*time.Minute)), "Should never expire without a TTL")
+
+	provisioned := rackhdNode{Tags: append(node.Tags, provisionedTag)}
+	assert.False(t, reservationExpired(provisioned, 60, reserved.Add(90*time.Minute)), "Should never expire once provisioned")
+
+	legacy := rackhdNode{Tags: []string{reservationTag}}
+	assert.False(t, reservationExpired(legacy, 60, reserved.Add(90*time.Minute)), "Should never expire without a timestamp")
+}
@@ -0,0 +1,82 @@
+package rackhd
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	selectionFirstFit    = "first-fit"
+	selectionRandom      = "random"
+	selectionLRU         = "lru"
+	selectionSmallestFit = "smallest-fit"
+
+	// releasedTagPrefix is followed by the Unix time at which the node was
+	// last released back to its pool by a failed create or a reclaimed
+	// reservation.
+	releasedTagPrefix = "dockermachine-released:"
+)
+
+func validateSelection(strategy string) error {
+	switch strategy {
+	case selectionFirstFit, selectionRandom, selectionLRU, selectionSmallestFit:
+		return nil
+	}
+	return fmt.Errorf("Unsupported node selection strategy %q. Specify first-fit, random, lru or smallest-fit", strategy)
+}
+
+// returnedAt returns when the node last came back to its pool: when it was
+// discovered, or when it was released later on. Remove deletes the node from
+// RackHD, so a node whose machine was removed comes back through discovery
+// with a new record.
+func returnedAt(node rackhdNode) time.Time {
+	// a missing discovery time parses as the zero time
+	latest, _ := time.Parse(time.RFC3339, node.CreatedAt)
+	for _, tag := range node.Tags {
+		if !strings.HasPrefix(tag, releasedTagPrefix) {
+			continue
+		}
+		secs, err := strconv.ParseInt(strings.TrimPrefix(tag, releasedTagPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(secs, 0); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// meetsRequirements reports whether the hardware has at least the given
+// number of CPUs and MB of memory. A requirement of 0 is ignored.
+func meetsRequirements(hw *nodeHardware, minCPUs, minMemoryMB int) bool {
+	return hw.CPUs >= minCPUs && hw.MemoryMB >= minMemoryMB
+}
+
+// selectNode picks one of the candidates using the strategy. hardware is
+// only consulted by smallest-fit and must hold every candidate then.
+func selectNode(strategy string, candidates []rackhdNode, hardware map[string]*nodeHardware) rackhdNode {
+	chosen := candidates[0]
+	switch strategy {
+	case selectionRandom:
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		chosen = candidates[r.Intn(len(candidates))]
+	case selectionLRU:
+		for _, node := range candidates[1:] {
+			if returnedAt(node).Before(returnedAt(chosen)) {
+				chosen = node
+			}
+		}
+	case selectionSmallestFit:
+		for _, node := range candidates[1:] {
+			hw, best := hardware[node.ID], hardware[chosen.ID]
+			if hw.CPUs < best.CPUs || (hw.CPUs == best.CPUs && hw.MemoryMB < best.MemoryMB) {
+				chosen = node
+			}
+		}
+	}
+	return chosen
+}
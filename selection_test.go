@@ -0,0 +1,50 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectNode(t *testing.T) {
+	candidates := []rackhdNode{
+		{ID: "a", Tags: []string{releasedTagPrefix + "1500000000"}},
+		{ID: "b", Tags: []string{releasedTagPrefix + "1400000000", releasedTagPrefix + "1450000000"}},
+		{ID: "c", Tags: []string{releasedTagPrefix + "1480000000"}},
+	}
+	hardware := map[string]*nodeHardware{
+		"a": {CPUs: 16, MemoryMB: 65536},
+		"b": {CPUs: 8, MemoryMB: 65536},
+		"c": {CPUs: 8, MemoryMB: 32768},
+	}
+
+	assert.Equal(t, "a", selectNode(selectionFirstFit, candidates, hardware).ID)
+	assert.Equal(t, "b", selectNode(selectionLRU, candidates, hardware).ID)
+	assert.Equal(t, "c", selectNode(selectionSmallestFit, candidates, hardware).ID)
+	assert.Contains(t, []string{"a", "b", "c"}, selectNode(selectionRandom, candidates, hardware).ID)
+
+	neverReleased := append(candidates, rackhdNode{ID: "d"})
+	assert.Equal(t, "d", selectNode(selectionLRU, neverReleased, hardware).ID, "Nodes never released should be used first")
+
+	rediscovered := []rackhdNode{candidates[1], {ID: "e", CreatedAt: "2017-03-01T10:00:00.000Z"}}
+	assert.Equal(t, "b", selectNode(selectionLRU, rediscovered, hardware).ID, "Nodes discovered recently should be used last")
+	rediscovered[1].CreatedAt = "2014-03-01T10:00:00.000Z"
+	assert.Equal(t, "e", selectNode(selectionLRU, rediscovered, hardware).ID)
+}
+
+func TestMeetsRequirements(t *testing.T) {
+	hw := &nodeHardware{CPUs: 8, MemoryMB: 32768}
+	assert.True(t, meetsRequirements(hw, 0, 0))
+	assert.True(t, meetsRequirements(hw, 8, 32768))
+	assert.False(t, meetsRequirements(hw, 16, 0))
+	assert.False(t, meetsRequirements(hw, 0, 65536))
+}
+
+func TestParseOhaiMemory(t *testing.T) {
+	mb, err := parseOhaiMemory("16333444kB")
+	assert.NoError(t, err)
+	assert.Equal(t, 15950, mb)
+
+	_, err = parseOhaiMemory("lots")
+	assert.Error(t, err)
+}
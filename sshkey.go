@@ -0,0 +1,181 @@
+package rackhd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	sshKeyTypeRSA     = "rsa"
+	sshKeyTypeECDSA   = "ecdsa"
+	sshKeyTypeED25519 = "ed25519"
+
+	defaultRSAKeyBits   = 2048
+	defaultECDSAKeyBits = 256
+)
+
+// validateSSHKeyType checks that the key type is supported and that bits is
+// a usable size for it. A bits value of 0 selects the default for the type.
+func validateSSHKeyType(keyType string, bits int) error {
+	switch keyType {
+	case sshKeyTypeRSA:
+		if bits != 0 && bits < defaultRSAKeyBits {
+			return fmt.Errorf("RSA SSH keys must be at least %d bits, got %d", defaultRSAKeyBits, bits)
+		}
+	case sshKeyTypeECDSA:
+		if _, err := ecdsaCurve(bits); err != nil {
+			return err
+		}
+	case sshKeyTypeED25519:
+		if bits != 0 {
+			return fmt.Errorf("ed25519 SSH keys have a fixed size, --rackhd-ssh-key-bits cannot be used")
+		}
+	default:
+		return fmt.Errorf("Unsupported SSH key type %q. Specify rsa, ecdsa or ed25519", keyType)
+	}
+	return nil
+}
+
+func ecdsaCurve(bits int) (elliptic.Curve, error) {
+	switch bits {
+	case 0, 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("ECDSA SSH keys must be 256, 384 or 521 bits, got %d", bits)
+}
+
+// generateSSHKey writes a new key pair of the given type to privPath and
+// pubPath in OpenSSH format. Like libmachine's ssh.GenerateSSHKey, an
+// existing private key is left untouched.
+func generateSSHKey(privPath, pubPath, keyType string, bits int) error {
+	if _, err := os.Stat(privPath); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Desired directory for SSH keys does not exist: %s", err)
+	}
+
+	var (
+		pub   interface{}
+		block *pem.Block
+	)
+
+	switch keyType {
+	case sshKeyTypeRSA, "":
+		if bits == 0 {
+			bits = defaultRSAKeyBits
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return err
+		}
+		pub = &key.PublicKey
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case sshKeyTypeECDSA:
+		curve, err := ecdsaCurve(bits)
+		if err != nil {
+			return err
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		pub = &key.PublicKey
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case sshKeyTypeED25519:
+		pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := marshalED25519PrivateKey(pubKey, privKey)
+		if err != nil {
+			return err
+		}
+		pub = pubKey
+		block = &pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: der}
+	default:
+		return fmt.Errorf("Unsupported SSH key type %q", keyType)
+	}
+
+	sshPub, err := cryptossh.NewPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(privPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pubPath, cryptossh.MarshalAuthorizedKey(sshPub), 0644)
+}
+
+// marshalED25519PrivateKey encodes an unencrypted ed25519 key in the
+// "openssh-key-v1" format, which is the only format OpenSSH reads them from.
+func marshalED25519PrivateKey(pub ed25519.PublicKey, priv ed25519.PrivateKey) ([]byte, error) {
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+	checkInt := binary.BigEndian.Uint32(check[:])
+
+	sshPub, err := cryptossh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	privBlock := struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+		Pad     []byte `ssh:"rest"`
+	}{
+		Check1:  checkInt,
+		Check2:  checkInt,
+		Keytype: cryptossh.KeyAlgoED25519,
+		Pub:     []byte(pub),
+		Priv:    []byte(priv),
+	}
+
+	// The private section is padded to the cipher block size, 8 for "none"
+	unpadded := len(cryptossh.Marshal(privBlock))
+	for i := 1; (unpadded+len(privBlock.Pad))%8 != 0; i++ {
+		privBlock.Pad = append(privBlock.Pad, byte(i))
+	}
+
+	key := struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       sshPub.Marshal(),
+		PrivKeyBlock: cryptossh.Marshal(privBlock),
+	}
+
+	return append([]byte("openssh-key-v1\x00"), cryptossh.Marshal(key)...), nil
+}
@@ -0,0 +1,51 @@
+package rackhd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSSHKeyTypes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rackhd-sshkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, keyType := range []string{sshKeyTypeRSA, sshKeyTypeECDSA, sshKeyTypeED25519} {
+		privPath := filepath.Join(dir, keyType)
+		pubPath := privPath + ".pub"
+
+		err := generateSSHKey(privPath, pubPath, keyType, 0)
+		assert.NoError(t, err)
+
+		priv, err := ioutil.ReadFile(privPath)
+		assert.NoError(t, err)
+		signer, err := cryptossh.ParsePrivateKey(priv)
+		if !assert.NoError(t, err, keyType) {
+			continue
+		}
+
+		pub, err := ioutil.ReadFile(pubPath)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(cryptossh.MarshalAuthorizedKey(signer.PublicKey()), pub), keyType)
+	}
+}
+
+func TestValidateSSHKeyType(t *testing.T) {
+	assert.NoError(t, validateSSHKeyType("rsa", 0))
+	assert.NoError(t, validateSSHKeyType("rsa", 4096))
+	assert.NoError(t, validateSSHKeyType("ecdsa", 384))
+	assert.NoError(t, validateSSHKeyType("ed25519", 0))
+
+	assert.Error(t, validateSSHKeyType("rsa", 1024), "Should error on weak RSA keys")
+	assert.Error(t, validateSSHKeyType("ecdsa", 2048), "Should error on unsupported ECDSA curve")
+	assert.Error(t, validateSSHKeyType("ed25519", 256), "Should error on sized ed25519 keys")
+	assert.Error(t, validateSSHKeyType("dsa", 0), "Should error on unsupported key type")
+}
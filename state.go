@@ -0,0 +1,83 @@
+package rackhd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codedellemc/gorackhd-redfish/client/redfish_v1"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// Redfish health values of a resource status
+const (
+	healthOK       = "OK"
+	healthWarning  = "Warning"
+	healthCritical = "Critical"
+)
+
+// computerSystem is the part of a Redfish ComputerSystem the driver uses to
+// work out the state of the machine.
+type computerSystem struct {
+	PowerState string `json:"PowerState"`
+	Status     struct {
+		State        string `json:"State"`
+		Health       string `json:"Health"`
+		HealthRollup string `json:"HealthRollup"`
+	} `json:"Status"`
+}
+
+func (d *Driver) getComputerSystem() (*computerSystem, error) {
+	clientRedfish := d.getClientRedfish()
+	resp, err := clientRedfish.RedfishV1.GetSystem(&redfish_v1.GetSystemParams{Identifier: d.NodeID})
+	if err != nil {
+		return nil, err
+	}
+
+	system := &computerSystem{}
+	if err := decodePayload(resp.Payload, system); err != nil {
+		return nil, fmt.Errorf("Unable to parse Redfish system %v. Error: %s", d.NodeID, err)
+	}
+	return system, nil
+}
+
+// systemState maps the Redfish power state and health of a system to a
+// machine state. A system in critical health is reported as an error, with
+// the power state in the message.
+func systemState(system *computerSystem) (state.State, error) {
+	health := system.Status.Health
+	if health == "" {
+		health = system.Status.HealthRollup
+	}
+
+	switch health {
+	case healthCritical:
+		return state.Error, fmt.Errorf("BMC reports critical health (power state %s, status %s)", system.PowerState, system.Status.State)
+	case healthWarning:
+		log.Warnf("BMC reports health %s (power state %s, status %s)", health, system.PowerState, system.Status.State)
+	}
+
+	switch strings.ToLower(system.PowerState) {
+	case "on", "online", "up":
+		return state.Running, nil
+	case "off", "offline", "down":
+		return state.Stopped, nil
+	case "poweringon":
+		return state.Starting, nil
+	case "poweringoff":
+		return state.Stopping, nil
+	case "", "unknown":
+		return state.None, nil
+	}
+	return state.Error, fmt.Errorf("Unknown power state %q", system.PowerState)
+}
+
+// workflowState maps a workflow running on the node to a machine state. The
+// power off graph stops the machine, every other graph, such as power on,
+// reboot or provisioning, is bringing it up.
+func workflowState(wf *nodeWorkflow, powerOffGraph string) state.State {
+	if wf.Name == powerOffGraph {
+		return state.Stopping
+	}
+	return state.Starting
+}
@@ -0,0 +1,51 @@
+package rackhd
+
+import (
+	"testing"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemState(t *testing.T) {
+	tests := map[string]state.State{
+		"On":          state.Running,
+		"online":      state.Running,
+		"Off":         state.Stopped,
+		"PoweringOn":  state.Starting,
+		"PoweringOff": state.Stopping,
+		"Unknown":     state.None,
+	}
+	for powerState, want := range tests {
+		s, err := systemState(&computerSystem{PowerState: powerState})
+		assert.NoError(t, err, powerState)
+		assert.Equal(t, want, s, powerState)
+	}
+
+	s, err := systemState(&computerSystem{PowerState: "Hibernating"})
+	assert.Error(t, err, "Unrecognised power states should be reported")
+	assert.Equal(t, state.Error, s)
+}
+
+func TestSystemStateHealth(t *testing.T) {
+	system := &computerSystem{PowerState: "On"}
+	system.Status.Health = healthWarning
+
+	s, err := systemState(system)
+	assert.NoError(t, err, "A warning should not hide the power state")
+	assert.Equal(t, state.Running, s)
+
+	system.Status.Health = ""
+	system.Status.HealthRollup = healthCritical
+
+	s, err = systemState(system)
+	assert.Error(t, err)
+	assert.Equal(t, state.Error, s)
+	assert.Contains(t, err.Error(), "critical")
+}
+
+func TestWorkflowState(t *testing.T) {
+	assert.Equal(t, state.Stopping, workflowState(&nodeWorkflow{Name: "Graph.PowerOff.Node"}, "Graph.PowerOff.Node"))
+	assert.Equal(t, state.Starting, workflowState(&nodeWorkflow{Name: "Graph.PowerOn.Node"}, "Graph.PowerOff.Node"))
+	assert.Equal(t, state.Starting, workflowState(&nodeWorkflow{Name: "Graph.InstallCoreOS"}, "Graph.PowerOff.Node"))
+}